@@ -0,0 +1,474 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binhgo/foosee/util"
+)
+
+// AdminPrincipal principal of websocket connections logged in by admin.login
+const AdminPrincipal = "@admin"
+
+// minAdminSecret minimum length of admin shared secret
+const minAdminSecret = 16
+
+const (
+	// adminMaxFailures failed authentications after which an IP is locked out
+	adminMaxFailures = 5
+	// adminLockout failures of an IP are forgotten this long after the last one
+	adminLockout = time.Minute
+)
+
+// AdminDBInfo ...
+type AdminDBInfo struct {
+	Name      string   `json:"name"`
+	Address   []string `json:"address"`
+	Database  string   `json:"database,omitempty"`
+	Connected bool     `json:"connected"`
+}
+
+// AdminQueueInfo ...
+type AdminQueueInfo struct {
+	Name  string `json:"name"`
+	Depth int64  `json:"depth"`
+	Error string `json:"error,omitempty"`
+}
+
+// AdminCacheInfo ...
+type AdminCacheInfo struct {
+	Name string `json:"name"`
+	CacheStats
+}
+
+// AdminOverview snapshot of the running app
+type AdminOverview struct {
+	App         string            `json:"app"`
+	Host        string            `json:"host"`
+	Env         string            `json:"env,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	State       AppState          `json:"state"`
+	Components  []ComponentStatus `json:"components"`
+	Connections []ConnectionInfo  `json:"connections"`
+	Actions     []HandlerInfo     `json:"actions"`
+	DBs         []AdminDBInfo     `json:"dbs"`
+	Queues      []AdminQueueInfo  `json:"queues"`
+	Caches      []AdminCacheInfo  `json:"caches"`
+	Workers     []WorkerStatus    `json:"workers"`
+}
+
+// AddCache register cache in app services, so admin console can report its size & flush it
+func (app *App) AddCache(name string, cache *LCache) {
+	app.Services.AddCache(name, cache)
+}
+
+// Cache find registered cache by name, nil if not found
+func (app *App) Cache(name string) *LCache {
+	return app.Services.Cache(name)
+}
+
+// AdminOverview ...
+func (app *App) AdminOverview(ctx context.Context) *AdminOverview {
+	o := &AdminOverview{
+		App:         app.Name,
+		Host:        app.hostname,
+		Env:         Env(),
+		Version:     Version(),
+		State:       app.State(),
+		Components:  app.Components(),
+		Connections: []ConnectionInfo{},
+		Actions:     []HandlerInfo{},
+		Workers:     app.Workers(),
+	}
+	if app.Server != nil && app.Server.Router != nil {
+		o.Connections = app.Server.Connections()
+		o.Actions = app.Server.Actions()
+	}
+	o.DBs = app.adminDBs()
+	o.Queues = app.adminQueues()
+	o.Caches = app.adminCaches()
+	return o
+}
+
+func (app *App) adminDBs() []AdminDBInfo {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	list := make([]AdminDBInfo, 0, len(app.DBList))
+	for _, db := range app.DBList {
+		s := db.Session()
+		list = append(list, AdminDBInfo{
+			Name:      db.Name,
+			Address:   db.Config.Address,
+			Database:  db.Config.AuthDB,
+			Connected: s != nil && s.Valid(),
+		})
+	}
+	return list
+}
+
+func (app *App) adminQueues() []AdminQueueInfo {
+	app.lock.Lock()
+	queues := make([]*DBQueue2, len(app.QueueList))
+	copy(queues, app.QueueList)
+	app.lock.Unlock()
+
+	list := make([]AdminQueueInfo, 0, len(queues))
+	for _, q := range queues {
+		info := AdminQueueInfo{Name: q.ColName}
+		depth, err := q.Depth()
+		if err != nil {
+			info.Error = err.Error()
+		}
+		info.Depth = depth
+		list = append(list, info)
+	}
+	return list
+}
+
+func (app *App) adminCaches() []AdminCacheInfo {
+	names := app.Services.CacheNames()
+	list := make([]AdminCacheInfo, 0, len(names))
+	for _, name := range names {
+		if c := app.Services.Cache(name); c != nil {
+			list = append(list, AdminCacheInfo{Name: name, CacheStats: c.Stats()})
+		}
+	}
+	return list
+}
+
+// adminDisconnect close websocket connection by id
+func (app *App) adminDisconnect(id string, by string) *Response {
+	if app.Server == nil || app.Server.Router == nil {
+		return &Response{Status: APIStatus.NotFound, Message: "API server is not set up."}
+	}
+	err := app.Server.Disconnect(id)
+	if err != nil {
+		return &Response{Status: APIStatus.NotFound, Message: err.Error()}
+	}
+	app.logger.Info("Admin disconnected client", F("conn", id), F("by", by))
+	return &Response{Status: APIStatus.Ok, Message: "Disconnect " + id + " successfully."}
+}
+
+// adminFlushCache remove all items of registered cache
+func (app *App) adminFlushCache(name string, by string) *Response {
+	cache := app.Cache(name)
+	if cache == nil {
+		return &Response{Status: APIStatus.NotFound, Message: "Not found cache " + name + "."}
+	}
+	cache.Cleanup()
+	app.logger.Info("Admin flushed cache", F("cache", name), F("by", by))
+	return &Response{Status: APIStatus.Ok, Message: "Flush cache " + name + " successfully."}
+}
+
+// AdminHandler admin console, every request requires header "Authorization: Bearer <secret>".
+// An IP failing it adminMaxFailures times in a row is rejected until adminLockout after its last failure.
+//
+//	GET  /admin                               overview of everything below
+//	GET  /admin/connections
+//	POST /admin/connections/{id}/disconnect
+//	GET  /admin/actions
+//	GET  /admin/db
+//	GET  /admin/queues
+//	GET  /admin/caches
+//	POST /admin/caches/{name}/flush
+//	     /admin/workers/...                   see WorkerHandler
+func (app *App) AdminHandler(secret string) http.Handler {
+	workers := http.StripPrefix("/admin", app.workerHandler())
+	return app.requireSecret(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] != "admin" {
+			writeResponse(w, http.StatusNotFound, &Response{Status: APIStatus.NotFound, Message: "Not found " + r.URL.Path + "."})
+			return
+		}
+		if len(parts) > 1 && parts[1] == "workers" {
+			workers.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			app.serveAdminQuery(w, r, parts[1:])
+			return
+		}
+		if r.Method != http.MethodPost || len(parts) != 4 {
+			writeResponse(w, http.StatusNotFound, &Response{Status: APIStatus.NotFound, Message: "Not found " + r.Method + " " + r.URL.Path + "."})
+			return
+		}
+
+		var resp *Response
+		switch parts[1] + "/" + parts[3] {
+		case "connections/disconnect":
+			resp = app.adminDisconnect(parts[2], r.RemoteAddr)
+		case "caches/flush":
+			resp = app.adminFlushCache(parts[2], r.RemoteAddr)
+		default:
+			resp = &Response{Status: APIStatus.NotFound, Message: "Not found " + r.Method + " " + r.URL.Path + "."}
+		}
+		writeResponse(w, httpStatus(resp.Status), resp)
+	}))
+}
+
+// requireSecret reject requests without header "Authorization: Bearer <secret>".
+// An IP failing it adminMaxFailures times in a row is rejected until adminLockout after its last failure.
+func (app *App) requireSecret(secret string, next http.Handler) http.Handler {
+	limiter := newAuthLimiter()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+		if limiter.locked(ip) {
+			writeResponse(w, http.StatusTooManyRequests, &Response{Status: APIStatus.Forbidden, Message: "Too many failed attempts, retry later."})
+			return
+		}
+		if !checkSecret(secret, bearerToken(r)) {
+			limiter.fail(ip)
+			app.logger.Warn("Admin request unauthorized", F("remote", r.RemoteAddr), F("path", r.URL.Path))
+			writeResponse(w, http.StatusUnauthorized, &Response{Status: APIStatus.Unauthorized, Message: "Invalid admin secret."})
+			return
+		}
+		limiter.succeed(ip)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *App) serveAdminQuery(w http.ResponseWriter, r *http.Request, parts []string) {
+	var data interface{}
+	switch strings.Join(parts, "/") {
+	case "":
+		data = app.AdminOverview(r.Context())
+	case "connections":
+		data = []ConnectionInfo{}
+		if app.Server != nil && app.Server.Router != nil {
+			data = app.Server.Connections()
+		}
+	case "actions":
+		data = []HandlerInfo{}
+		if app.Server != nil && app.Server.Router != nil {
+			data = app.Server.Actions()
+		}
+	case "db":
+		data = app.adminDBs()
+	case "queues":
+		data = app.adminQueues()
+	case "caches":
+		data = app.adminCaches()
+	default:
+		writeResponse(w, http.StatusNotFound, &Response{Status: APIStatus.NotFound, Message: "Not found " + r.URL.Path + "."})
+		return
+	}
+	writeResponse(w, http.StatusOK, &Response{Status: APIStatus.Ok, Message: "Query successfully.", Data: data})
+}
+
+// SetupAdminServer serve admin console on addr while app is running,
+// empty addr & secret mean server.adminListen & server.adminSecret of loaded config
+func (app *App) SetupAdminServer(addr string, secret string) error {
+	if cfg := app.Config(); cfg != nil {
+		if addr == "" {
+			addr = cfg.Server.AdminListen
+		}
+		if secret == "" {
+			secret = cfg.Server.AdminSecret
+		}
+	}
+	if len(secret) < minAdminSecret {
+		return &Error{Type: "INVALID_SECRET", Message: "Admin secret requires at least " + strconv.Itoa(minAdminSecret) + " characters."}
+	}
+	app.Register("admin", &httpComponent{
+		server: &http.Server{Addr: addr, Handler: app.AdminHandler(secret)},
+		logger: app.logger,
+	})
+	return nil
+}
+
+type adminRequest struct {
+	Secret  string `json:"secret"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Seconds string `json:"seconds"`
+}
+
+// SetupAdminActions register websocket actions of admin console on app server.
+// A connection must first send admin.login with {"secret": ...}, failures lock out its IP like AdminHandler.
+// Other actions:
+//
+//	admin.overview
+//	admin.disconnect   {"id": connection id}
+//	admin.flushCache   {"name": cache name}
+//	admin.worker       {"name": worker name, "command": "pause|resume|trigger|period", "seconds": "60"}
+func (app *App) SetupAdminActions(secret string) error {
+	if app.Server == nil || app.Server.Router == nil {
+		return &Error{Type: "NOT_READY", Message: "Require to set up API server before admin actions."}
+	}
+	if secret == "" {
+		if cfg := app.Config(); cfg != nil {
+			secret = cfg.Server.AdminSecret
+		}
+	}
+	if len(secret) < minAdminSecret {
+		return &Error{Type: "INVALID_SECRET", Message: "Admin secret requires at least " + strconv.Itoa(minAdminSecret) + " characters."}
+	}
+
+	// same lockout as AdminHandler, keyed by the peer address of the connection
+	limiter := newAuthLimiter()
+	g := app.Server.Group("admin")
+	g.SetHandle("login", func(ctx context.Context, request Request) Response {
+		conn := app.Server.connectionByID(ConnIDFromContext(ctx))
+		if conn == nil {
+			return Response{Status: APIStatus.Unauthorized, Message: "Require a websocket connection."}
+		}
+		ip := hostOf(conn.Info().RemoteAddr)
+		if limiter.locked(ip) {
+			return Response{Status: APIStatus.Forbidden, Message: "Too many failed attempts, retry later."}
+		}
+		var req adminRequest
+		if err := decodeRequestData(request, &req); err != nil {
+			return invalidAdminRequest(err)
+		}
+		if !checkSecret(secret, req.Secret) {
+			limiter.fail(ip)
+			app.logger.Warn("Admin login failed", F("conn", conn.ID), F("remote", conn.Info().RemoteAddr))
+			return Response{Status: APIStatus.Unauthorized, Message: "Invalid admin secret."}
+		}
+		limiter.succeed(ip)
+		conn.SetPrincipal(AdminPrincipal)
+		app.logger.Info("Admin logged in", F("conn", conn.ID))
+		return Response{Status: APIStatus.Ok, Message: "Login successfully."}
+	}).SetDescription("Login to admin console with shared secret.")
+
+	g.SetHandle("overview", adminOnly(func(ctx context.Context, request Request) Response {
+		return Response{Status: APIStatus.Ok, Message: "Query successfully.", Data: app.AdminOverview(ctx)}
+	})).SetDescription("Connections, actions, DBs, queues, caches and workers of the app.")
+
+	g.SetHandle("disconnect", adminOnly(func(ctx context.Context, request Request) Response {
+		var req adminRequest
+		if err := decodeRequestData(request, &req); err != nil {
+			return invalidAdminRequest(err)
+		}
+		return *app.adminDisconnect(req.ID, "conn "+ConnIDFromContext(ctx))
+	})).SetDescription("Close a client connection by id.")
+
+	g.SetHandle("flushCache", adminOnly(func(ctx context.Context, request Request) Response {
+		var req adminRequest
+		if err := decodeRequestData(request, &req); err != nil {
+			return invalidAdminRequest(err)
+		}
+		return *app.adminFlushCache(req.Name, "conn "+ConnIDFromContext(ctx))
+	})).SetDescription("Remove all items of a registered cache.")
+
+	g.SetHandle("worker", adminOnly(func(ctx context.Context, request Request) Response {
+		var req adminRequest
+		if err := decodeRequestData(request, &req); err != nil {
+			return invalidAdminRequest(err)
+		}
+		worker := app.Worker(req.Name)
+		if worker == nil {
+			return Response{Status: APIStatus.NotFound, Message: "Not found worker " + req.Name + "."}
+		}
+		_, resp := app.controlWorker(worker, req.Command, req.Seconds, "conn "+ConnIDFromContext(ctx))
+		return *resp
+	})).SetDescription("Pause, resume, trigger or change period of a worker.")
+	return nil
+}
+
+// adminOnly reject connections not logged in by admin.login
+func adminOnly(fn HandleFunc) HandleFunc {
+	return func(ctx context.Context, request Request) Response {
+		if PrincipalFromContext(ctx) != AdminPrincipal {
+			return Response{Status: APIStatus.Forbidden, Message: "Require admin login."}
+		}
+		return fn(ctx, request)
+	}
+}
+
+func invalidAdminRequest(err error) Response {
+	return Response{Status: APIStatus.Invalid, Message: "Invalid request data: " + err.Error()}
+}
+
+func decodeRequestData(request Request, v interface{}) error {
+	b, err := util.ToJson(request.Data)
+	if err != nil {
+		return err
+	}
+	return util.FromJson(b, v)
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// authLimiter count failed authentications by IP
+type authLimiter struct {
+	failures *Cache[string, int]
+	lock     sync.Mutex
+}
+
+func newAuthLimiter() *authLimiter {
+	return &authLimiter{failures: NewCache[string, int](10000, adminLockout, false)}
+}
+
+func (l *authLimiter) locked(ip string) bool {
+	n, _ := l.failures.Get(ip)
+	return n >= adminMaxFailures
+}
+
+func (l *authLimiter) fail(ip string) {
+	l.lock.Lock()
+	n, _ := l.failures.Get(ip)
+	l.failures.Put(ip, n+1)
+	l.lock.Unlock()
+}
+
+func (l *authLimiter) succeed(ip string) {
+	if l.failures.ContainsKey(ip) {
+		l.failures.Remove(ip)
+	}
+}
+
+// remoteIP peer address without port, proxy headers are not trusted
+func remoteIP(r *http.Request) string {
+	return hostOf(r.RemoteAddr)
+}
+
+// hostOf addr without port, addr itself if it has none
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// checkSecret constant time comparison, hashing first so the length is not leaked either
+func checkSecret(secret string, given string) bool {
+	if secret == "" || given == "" {
+		return false
+	}
+	a := sha256.Sum256([]byte(secret))
+	b := sha256.Sum256([]byte(given))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+func httpStatus(status string) int {
+	switch status {
+	case APIStatus.Ok:
+		return http.StatusOK
+	case APIStatus.NotFound:
+		return http.StatusNotFound
+	case APIStatus.Invalid:
+		return http.StatusBadRequest
+	case APIStatus.Unauthorized:
+		return http.StatusUnauthorized
+	case APIStatus.Forbidden:
+		return http.StatusForbidden
+	}
+	return http.StatusConflict
+}
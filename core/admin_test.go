@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAdminSecret = "0123456789abcdef"
+
+func adminGet(h http.Handler, remote string, secret string) int {
+	r := httptest.NewRequest(http.MethodGet, "/admin/caches", nil)
+	r.RemoteAddr = remote
+	if secret != "" {
+		r.Header.Set("Authorization", "Bearer "+secret)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestAdminHandlerAuth(t *testing.T) {
+	app := NewApp("test")
+	h := app.AdminHandler(testAdminSecret)
+
+	if code := adminGet(h, "10.0.0.1:1000", ""); code != http.StatusUnauthorized {
+		t.Fatalf("request without secret = %d, want 401", code)
+	}
+	if code := adminGet(h, "10.0.0.1:1000", testAdminSecret); code != http.StatusOK {
+		t.Fatalf("request with secret = %d, want 200", code)
+	}
+
+	for i := 0; i < adminMaxFailures; i++ {
+		if code := adminGet(h, "10.0.0.2:1000", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("failure %d = %d, want 401", i+1, code)
+		}
+	}
+	// locked out by IP, whatever the port & secret
+	if code := adminGet(h, "10.0.0.2:2000", testAdminSecret); code != http.StatusTooManyRequests {
+		t.Fatalf("request of a locked out IP = %d, want 429", code)
+	}
+	if code := adminGet(h, "10.0.0.1:1000", testAdminSecret); code != http.StatusOK {
+		t.Fatalf("request of another IP = %d, want 200", code)
+	}
+}
+
+func TestAdminHandlerSuccessResetsFailures(t *testing.T) {
+	app := NewApp("test")
+	h := app.AdminHandler(testAdminSecret)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < adminMaxFailures-1; i++ {
+			adminGet(h, "10.0.0.1:1000", "wrong")
+		}
+		if code := adminGet(h, "10.0.0.1:1000", testAdminSecret); code != http.StatusOK {
+			t.Fatalf("round %d: request with secret = %d, want 200", round, code)
+		}
+	}
+}
+
+func TestWorkerHandlerAuth(t *testing.T) {
+	app := NewApp("test")
+	h := app.WorkerHandler(testAdminSecret)
+	r := httptest.NewRequest(http.MethodGet, "/workers", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("request without secret = %d, want 401", w.Code)
+	}
+}
+
+// addrConn connection with a chosen peer address
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// adminConn open a connection from ip on the server of app
+func adminConn(t *testing.T, app *App, ip string) *Connection {
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	conn := &addrConn{Conn: server, remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1000}}
+	return app.Server.connection(conn)
+}
+
+// adminCall run action as the server does, with the current principal of conn
+func adminCall(app *App, conn *Connection, action string, data interface{}) Response {
+	handler := app.Server.Router.Match(action)
+	ctx := newRequestContext(conn.Context(), conn, newTraceID())
+	return handler.Fn(ctx, Request{Action: action, Data: data})
+}
+
+func testAdminActions(t *testing.T) *App {
+	app := NewApp("test")
+	if _, err := app.SetupAPIServer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.SetupAdminActions(testAdminSecret); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Server.Stop)
+	return app
+}
+
+func TestAdminActionsLogin(t *testing.T) {
+	app := testAdminActions(t)
+	conn := adminConn(t, app, "10.0.0.1")
+
+	if resp := adminCall(app, conn, "admin.overview", nil); resp.Status != APIStatus.Forbidden {
+		t.Fatalf("admin.overview before login = %s, want %s", resp.Status, APIStatus.Forbidden)
+	}
+	if resp := adminCall(app, conn, "admin.login", adminRequest{Secret: "wrong"}); resp.Status != APIStatus.Unauthorized {
+		t.Fatalf("admin.login with wrong secret = %s, want %s", resp.Status, APIStatus.Unauthorized)
+	}
+	if resp := adminCall(app, conn, "admin.login", "not an object"); resp.Status != APIStatus.Invalid {
+		t.Fatalf("admin.login with invalid data = %s, want %s", resp.Status, APIStatus.Invalid)
+	}
+	if resp := adminCall(app, conn, "admin.login", adminRequest{Secret: testAdminSecret}); resp.Status != APIStatus.Ok {
+		t.Fatalf("admin.login = %s %s, want %s", resp.Status, resp.Message, APIStatus.Ok)
+	}
+	if resp := adminCall(app, conn, "admin.overview", nil); resp.Status != APIStatus.Ok {
+		t.Fatalf("admin.overview after login = %s, want %s", resp.Status, APIStatus.Ok)
+	}
+	if resp := adminCall(app, conn, "admin.flushCache", []int{1}); resp.Status != APIStatus.Invalid {
+		t.Fatalf("admin.flushCache with invalid data = %s, want %s", resp.Status, APIStatus.Invalid)
+	}
+
+	// login is bound to the connection
+	other := adminConn(t, app, "10.0.0.1")
+	if resp := adminCall(app, other, "admin.disconnect", adminRequest{ID: conn.ID}); resp.Status != APIStatus.Forbidden {
+		t.Fatalf("admin.disconnect of another connection = %s, want %s", resp.Status, APIStatus.Forbidden)
+	}
+}
+
+func TestAdminActionsLockout(t *testing.T) {
+	app := testAdminActions(t)
+	for i := 0; i < adminMaxFailures; i++ {
+		// a new connection does not reset the count of its IP
+		conn := adminConn(t, app, "10.0.0.2")
+		if resp := adminCall(app, conn, "admin.login", adminRequest{Secret: "wrong"}); resp.Status != APIStatus.Unauthorized {
+			t.Fatalf("failure %d = %s, want %s", i+1, resp.Status, APIStatus.Unauthorized)
+		}
+	}
+	conn := adminConn(t, app, "10.0.0.2")
+	if resp := adminCall(app, conn, "admin.login", adminRequest{Secret: testAdminSecret}); resp.Status != APIStatus.Forbidden {
+		t.Fatalf("admin.login of a locked out IP = %s, want %s", resp.Status, APIStatus.Forbidden)
+	}
+	if conn.Principal() == AdminPrincipal {
+		t.Fatal("locked out connection logged in")
+	}
+
+	conn = adminConn(t, app, "10.0.0.3")
+	if resp := adminCall(app, conn, "admin.login", adminRequest{Secret: testAdminSecret}); resp.Status != APIStatus.Ok {
+		t.Fatalf("admin.login of another IP = %s, want %s", resp.Status, APIStatus.Ok)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	called := false
+	fn := adminOnly(func(ctx context.Context, request Request) Response {
+		called = true
+		return Response{Status: APIStatus.Ok}
+	})
+	conn := newConnection(context.Background(), &addrConn{})
+	if resp := fn(newRequestContext(conn.Context(), conn, ""), Request{}); resp.Status != APIStatus.Forbidden || called {
+		t.Fatalf("anonymous request = %s, handler called %v, want %s", resp.Status, called, APIStatus.Forbidden)
+	}
+	conn.SetPrincipal("someone")
+	if resp := fn(newRequestContext(conn.Context(), conn, ""), Request{}); resp.Status != APIStatus.Forbidden || called {
+		t.Fatalf("request of another principal = %s, handler called %v, want %s", resp.Status, called, APIStatus.Forbidden)
+	}
+	conn.SetPrincipal(AdminPrincipal)
+	if resp := fn(newRequestContext(conn.Context(), conn, ""), Request{}); resp.Status != APIStatus.Ok || !called {
+		t.Fatalf("admin request = %s, handler called %v, want %s", resp.Status, called, APIStatus.Ok)
+	}
+}
@@ -1,21 +1,81 @@
 package core
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"syscall"
+	"time"
 )
 
+// Component part of the app started & stopped by App.
+// ctx only bounds the start / stop call itself, long-running work must not depend on it.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// AppState ...
+type AppState string
+
+// App lifecycle states
+const (
+	AppStateNew      AppState = "NEW"
+	AppStateStarting AppState = "STARTING"
+	AppStateRunning  AppState = "RUNNING"
+	AppStateStopping AppState = "STOPPING"
+	AppStateStopped  AppState = "STOPPED"
+	AppStateFailed   AppState = "FAILED"
+)
+
+// ComponentStatus state of one registered component
+type ComponentStatus struct {
+	Name  string   `json:"name"`
+	State AppState `json:"state"`
+	Error string   `json:"error,omitempty"`
+}
+
+type appComponent struct {
+	name      string
+	component Component
+	state     AppState
+	err       error
+}
+
+// label name of the component in reports & logs, workers are usually renamed after SetupWorker
+func (c *appComponent) label() string {
+	if w, ok := c.component.(*Worker); ok {
+		return "worker:" + w.Name
+	}
+	return c.name
+}
+
 // App ..
 type App struct {
 	Name             string
 	Server           *Server
 	DBList           []*DBClient
 	WorkerList       []*Worker
+	QueueList        []*DBQueue2
+	Metrics          *MetricRegistry
+	Services         *Services
 	onAllDBConnected Task
 	launched         bool
 	hostname         string
+	logger           Logger
+	workerMetrics    *workerMetrics
+
+	components      []*appComponent
+	healthChecks    []*healthCheck
+	config          *AppConfig
+	state           AppState
+	shutdownTimeout time.Duration
+	done            chan struct{}
+	lock            *sync.Mutex
 }
 
 // NewApp Wrap application
@@ -26,16 +86,43 @@ func NewApp(name string) *App {
 	}
 
 	app := &App{
-		Name:       name,
-		Server:     &Server{},
-		DBList:     []*DBClient{},
-		WorkerList: []*Worker{},
-		launched:   false,
-		hostname:   hostname,
+		Name:            name,
+		Server:          &Server{},
+		DBList:          []*DBClient{},
+		WorkerList:      []*Worker{},
+		Metrics:         NewMetricRegistry(),
+		Services:        NewServices(),
+		launched:        false,
+		hostname:        hostname,
+		state:           AppStateNew,
+		shutdownTimeout: 30 * time.Second,
+		done:            make(chan struct{}),
+		lock:            &sync.Mutex{},
 	}
+	app.logger = DefaultLogger.With(F("app", name), F("host", hostname))
+	app.workerMetrics = newWorkerMetrics(app.Metrics)
+	app.Metrics.register(&cacheCollector{services: app.Services})
 	return app
 }
 
+// SetLogger set logger of app, also used by components set up after this call
+func (app *App) SetLogger(logger Logger) {
+	app.logger = logger.With(F("app", app.Name), F("host", app.hostname))
+	if app.Server != nil {
+		app.Server.SetLogger(app.logger)
+	}
+}
+
+// Logger ...
+func (app *App) Logger() Logger {
+	return app.logger
+}
+
+// SetShutdownTimeout maximum time given to Stop when app receive SIGINT/SIGTERM
+func (app *App) SetShutdownTimeout(timeout time.Duration) {
+	app.shutdownTimeout = timeout
+}
+
 // SetupDBClient ...
 func (app *App) SetupDBClient(config DBConfiguration) *DBClient {
 	var db = &DBClient{Config: config}
@@ -43,7 +130,7 @@ func (app *App) SetupDBClient(config DBConfiguration) *DBClient {
 	return db
 }
 
-// SetupDBClient ...
+// OnAllDBConnected task executed after all DBs connected, before other components start
 func (app *App) OnAllDBConnected(task Task) {
 	app.onAllDBConnected = task
 }
@@ -51,64 +138,287 @@ func (app *App) OnAllDBConnected(task Task) {
 // SetupAPIServer ...
 func (app *App) SetupAPIServer() (*Server, error) {
 
+	var pollTimeout int64 = -10
+	cfg := app.Config()
+	if cfg != nil && cfg.Server.PollTimeout != 0 {
+		pollTimeout = cfg.Server.PollTimeout
+	}
+
 	var sv *Server
-	sv = NewServer(-10)
+	sv = newServer(pollTimeout, app.Metrics)
 	if sv == nil {
 		return nil, errors.New("server type " + " is invalid (HTTP/THRIFT)")
 	}
 
+	sv.SetLogger(app.logger)
+	sv.SetServices(app.Services)
 	app.Server = sv
+	app.Register("server", &serverComponent{server: sv})
+
+	if cfg != nil && cfg.Server.Listen != "" {
+		app.Register("websocket", &httpComponent{
+			server: &http.Server{Addr: cfg.Server.Listen, Handler: sv},
+			logger: app.logger,
+		})
+	}
+	if cfg != nil && cfg.Server.MetricsListen != "" {
+		app.Register("metrics", &httpComponent{
+			server: &http.Server{Addr: cfg.Server.MetricsListen, Handler: app.Metrics},
+			logger: app.logger,
+		})
+	}
 	return sv, nil
 }
 
-// SetupWorker ...
+// SetupWorker setup worker reporting its runs to app logger & metrics
 func (app *App) SetupWorker() *Worker {
-	var worker = &Worker{}
+	var worker = &Worker{logger: app.logger}
+	worker.OnSuccess(app.workerMetrics.observe)
+	worker.OnError(app.workerMetrics.observe)
+	app.lock.Lock()
+	worker.Name = "worker-" + strconv.Itoa(len(app.WorkerList)+1)
 	app.WorkerList = append(app.WorkerList, worker)
+	app.lock.Unlock()
+	app.Register("worker:"+worker.Name, worker)
 	return worker
 }
 
-// Launch Launch app
-func (app *App) Launch() error {
+// AddDBCache register cache as a component applying invalidations of other replicas while app runs,
+// it logs to app logger unless it has its own. Init must be called before Start.
+func (app *App) AddDBCache(cache *DBCache) {
+	if cache.logger == nil {
+		cache.SetLogger(app.logger)
+	}
+	app.Register("cache:"+cache.ColName, cache)
+}
 
-	if app.launched {
-		return nil
+// Register add component, components are started in registration order after DBs are connected
+// and stopped in reverse order
+func (app *App) Register(name string, component Component) {
+	app.lock.Lock()
+	app.components = append(app.components, &appComponent{
+		name:      name,
+		component: component,
+		state:     AppStateNew,
+	})
+	app.lock.Unlock()
+}
+
+// State ...
+func (app *App) State() AppState {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	return app.state
+}
+
+// Components report state of registered components
+func (app *App) Components() []ComponentStatus {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	list := make([]ComponentStatus, 0, len(app.components))
+	for _, c := range app.components {
+		st := ComponentStatus{Name: c.label(), State: c.state}
+		if c.err != nil {
+			st.Error = c.err.Error()
+		}
+		list = append(list, st)
 	}
+	return list
+}
 
-	app.launched = true
+func (app *App) setState(state AppState) {
+	app.lock.Lock()
+	app.state = state
+	app.lock.Unlock()
+}
+
+func (app *App) setComponentState(c *appComponent, state AppState, err error) {
+	app.lock.Lock()
+	c.state = state
+	c.err = err
+	app.lock.Unlock()
+}
+
+// Start connect DBs then start components in order.
+// If one fails, already started components are stopped in reverse order.
+func (app *App) Start(ctx context.Context) error {
+	app.lock.Lock()
+	if app.state != AppStateNew {
+		app.lock.Unlock()
+		return &Error{Type: "INVALID_STATE", Message: "App is " + string(app.state) + ", can only start once."}
+	}
+	app.state = AppStateStarting
+	components := make([]*appComponent, len(app.components))
+	copy(components, app.components)
+	app.lock.Unlock()
 
-	name := app.Name + " / " + app.hostname
-	fmt.Println("[ App " + name + " ] Launching ...")
-	var wg = sync.WaitGroup{}
+	app.logger.Info("Launching ...")
 
 	// start connect to DB
 	for _, db := range app.DBList {
 		err := db.Connect()
 		if err != nil {
-			fmt.Println("Connect DB error " + err.Error())
+			app.logger.Error("Connect DB error", F("db", db.Name), F("error", err))
+			app.disconnectDBs()
+			app.fail()
 			return err
 		}
 	}
 
-	fmt.Println("[ App " + name + " ] DBs connected.")
+	app.logger.Info("DBs connected.")
 
 	if app.onAllDBConnected != nil {
 		app.onAllDBConnected()
-		fmt.Println("[ App " + name + " ] On-all-DBs-connected handler executed.")
+		app.logger.Info("On-all-DBs-connected handler executed.")
 	}
 
-	// start servers
-	go app.Server.Start()
-	fmt.Println("[ App " + name + " ] Servers started.")
+	for i, c := range components {
+		app.setComponentState(c, AppStateStarting, nil)
+		err := c.component.Start(ctx)
+		if err != nil {
+			app.setComponentState(c, AppStateFailed, err)
+			app.logger.Error("Start component error", F("component", c.label()), F("error", err))
+			app.stopComponents(ctx, components[:i])
+			app.disconnectDBs()
+			app.fail()
+			return err
+		}
+		app.setComponentState(c, AppStateRunning, nil)
+		app.logger.Info("Component started.", F("component", c.label()))
+	}
 
-	// start workers
-	for _, wk := range app.WorkerList {
-		wg.Add(1)
-		go wk.Execute()
+	app.setState(AppStateRunning)
+	app.logger.Info("Totally launched!")
+	return nil
+}
+
+// Stop stop components in reverse order then disconnect DBs, Wait returns afterward
+func (app *App) Stop(ctx context.Context) error {
+	app.lock.Lock()
+	if app.state != AppStateRunning {
+		app.lock.Unlock()
+		return &Error{Type: "INVALID_STATE", Message: "App is " + string(app.state) + ", only running app can be stopped."}
+	}
+	app.state = AppStateStopping
+	components := make([]*appComponent, len(app.components))
+	copy(components, app.components)
+	app.lock.Unlock()
+
+	app.logger.Info("Stopping ...")
+	err := app.stopComponents(ctx, components)
+	app.disconnectDBs()
+
+	app.setState(AppStateStopped)
+	close(app.done)
+	app.logger.Info("Stopped.")
+	return err
+}
+
+// Wait block until app is stopped or failed to start
+func (app *App) Wait() {
+	<-app.done
+}
+
+// Launch start app, stop it on SIGINT/SIGTERM and block until stopped
+func (app *App) Launch() error {
+
+	if app.launched {
+		return nil
+	}
+
+	app.launched = true
+
+	err := app.Start(context.Background())
+	if err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case s := <-sig:
+		app.logger.Info("Received signal.", F("signal", s.String()))
+		ctx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout)
+		defer cancel()
+		return app.Stop(ctx)
+	case <-app.done:
+		return nil
+	}
+}
+
+func (app *App) fail() {
+	app.setState(AppStateFailed)
+	close(app.done)
+}
+
+// stopComponents stop in reverse order, return the first error
+func (app *App) stopComponents(ctx context.Context, components []*appComponent) error {
+	var first error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		app.setComponentState(c, AppStateStopping, nil)
+		err := c.component.Stop(ctx)
+		if err != nil {
+			app.setComponentState(c, AppStateFailed, err)
+			app.logger.Error("Stop component error", F("component", c.label()), F("error", err))
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		app.setComponentState(c, AppStateStopped, nil)
+		app.logger.Info("Component stopped.", F("component", c.label()))
+	}
+	return first
+}
+
+func (app *App) disconnectDBs() {
+	for i := len(app.DBList) - 1; i >= 0; i-- {
+		app.DBList[i].Close()
+	}
+}
+
+// workerMetrics ...
+type workerMetrics struct {
+	runs     *CounterVec
+	retries  *CounterVec
+	duration *HistogramVec
+}
+
+func newWorkerMetrics(r *MetricRegistry) *workerMetrics {
+	return &workerMetrics{
+		runs:     r.NewCounter("foosee_worker_runs_total", "Number of worker runs by worker and status.", "worker", "status"),
+		retries:  r.NewCounter("foosee_worker_retries_total", "Number of retried attempts by worker.", "worker"),
+		duration: r.NewHistogram("foosee_worker_run_duration_seconds", "Worker run duration including retries.", nil, "worker"),
+	}
+}
+
+func (m *workerMetrics) observe(worker *Worker, run WorkerRun, err error) {
+	status := "OK"
+	if err != nil {
+		status = "ERROR"
+	}
+	m.runs.With(worker.Name, status).Inc()
+	if run.Attempts > 1 {
+		m.retries.With(worker.Name).Add(float64(run.Attempts - 1))
 	}
-	fmt.Println("[ App " + name + " ] Workers started.")
-	fmt.Println("[ App " + name + " ] Totally launched!")
-	wg.Wait()
+	m.duration.With(worker.Name).Observe(run.Duration.Seconds())
+}
+
+// serverComponent run Server as a Component
+type serverComponent struct {
+	server *Server
+}
+
+func (c *serverComponent) Start(ctx context.Context) error {
+	go c.server.Start()
+	return nil
+}
 
+func (c *serverComponent) Stop(ctx context.Context) error {
+	c.server.Stop()
 	return nil
 }
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"fmt"
 	"net"
 	"sync"
 	"syscall"
@@ -38,8 +37,6 @@ func NewKQueue() *KQueue {
 
 func (k *KQueue) Add(wsConn net.Conn) error {
 
-	fmt.Println("add connection")
-
 	k.lock.Lock()
 	defer k.lock.Unlock()
 
@@ -59,15 +56,11 @@ func (k *KQueue) Add(wsConn net.Conn) error {
 
 	k.connections[fd] = wsConn
 
-	fmt.Println("add connection end")
-
 	return nil
 }
 
 func (k *KQueue) Remove(wsConn net.Conn) error {
 
-	fmt.Println("remove connection")
-
 	k.lock.Lock()
 	defer k.lock.Unlock()
 
@@ -86,8 +79,6 @@ func (k *KQueue) Remove(wsConn net.Conn) error {
 
 	delete(k.connections, fd)
 
-	fmt.Println("remove connection end")
-
 	return nil
 }
 
@@ -0,0 +1,378 @@
+package core
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	// dbCacheSkew invalidations are read again for this long, to catch events of replicas with late clocks
+	dbCacheSkew = 5 * time.Second
+	// dbCacheSyncLimit beyond this many invalidations in one sync, the whole L1 is dropped
+	dbCacheSyncLimit = 1000
+)
+
+// dbCacheEntry document of DBCache, value is decoded into TemplateObject on read
+type dbCacheEntry struct {
+	Key             string     `bson:"_id"`
+	Value           bson.Raw   `bson:"value"`
+	CreatedTime     *time.Time `bson:"created_time,omitempty"`
+	LastUpdatedTime *time.Time `bson:"last_updated_time,omitempty"`
+}
+
+// dbCacheInvalidation tell other replicas to drop key from their L1
+type dbCacheInvalidation struct {
+	ID          bson.ObjectId `bson:"_id,omitempty"`
+	Key         string        `bson:"key"`
+	Owner       string        `bson:"owner"`
+	CreatedTime *time.Time    `bson:"created_time,omitempty"`
+}
+
+// DBCache two-tier cache shared by replicas: L1 is a local LCache, L2 is collection ColName
+// where entries live for TTL after their last write (TTL index on last_updated_time).
+// Writes go to both tiers & are broadcast through collection ColName_invalidation,
+// other replicas drop the key from their L1 on their next sync.
+// A replica may serve a stale L1 value until the sync, or until the L1 ttl if it reloaded
+// the key from L2 while the write was in progress.
+type DBCache struct {
+	ColName string
+	// TemplateObject type of cached values, as in DBModel
+	TemplateObject interface{}
+	// L1 local tier, default NewLCache(10000, 60)
+	L1 *LCache
+	// TTL of entries in ColName, default 1 hour, Init updates the TTL index of an existing ColName
+	TTL time.Duration
+	// SyncInterval how often invalidations of other replicas are applied, default 1 second
+	SyncInterval time.Duration
+
+	entryDB *DBModel
+	eventDB *DBModel
+	owner   string
+	ready   bool
+	logger  Logger
+
+	// sync state, owned by the sync loop
+	since time.Time
+	seen  map[bson.ObjectId]time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+}
+
+// Init create collections & indexes, must be called before use
+func (c *DBCache) Init(mSession *DBSession, dbName string) error {
+	if c.TemplateObject == nil {
+		return &Error{Type: "INVALID_INPUT", Message: "Require template object of cached values."}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "undefined"
+	}
+	c.owner = hostname + "/" + strconv.Itoa(os.Getpid())
+	if c.L1 == nil {
+		c.L1 = NewLCache(10000, 60)
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Hour
+	}
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = time.Second
+	}
+
+	c.entryDB = &DBModel{
+		ColName:        c.ColName,
+		DBName:         dbName,
+		TemplateObject: &dbCacheEntry{},
+	}
+	err = c.entryDB.Init(mSession)
+	if err != nil {
+		return err
+	}
+	err = ensureTTLIndex(c.entryDB, "last_updated_time", c.TTL)
+	if err != nil {
+		return err
+	}
+
+	c.eventDB = &DBModel{
+		ColName:        c.ColName + "_invalidation",
+		DBName:         dbName,
+		TemplateObject: &dbCacheInvalidation{},
+	}
+	err = c.eventDB.Init(mSession)
+	if err != nil {
+		return err
+	}
+	// long enough for replicas paused by a GC or a slow sync
+	err = ensureTTLIndex(c.eventDB, "created_time", time.Hour)
+	if err != nil {
+		return err
+	}
+
+	c.ready = true
+	return nil
+}
+
+// mongoIndexOptionsConflict code of an index created again with other options
+const mongoIndexOptionsConflict = 85
+
+// ensureTTLIndex create TTL index on key, an existing one with another expiry (TTL changed since it
+// was created) is updated by collMod instead of failing Init
+func ensureTTLIndex(model *DBModel, key string, ttl time.Duration) error {
+	err := model.CreateIndex(mgo.Index{
+		Key:         []string{key},
+		Background:  true,
+		ExpireAfter: ttl,
+	})
+	if e, ok := err.(*mgo.QueryError); !ok || e.Code != mongoIndexOptionsConflict {
+		return err
+	}
+
+	s := model.GetFreshSession()
+	defer s.Close()
+	col, err := model.GetColWith(s)
+	if err != nil {
+		return err
+	}
+	return col.Database.Run(bson.D{
+		{Name: "collMod", Value: col.Name},
+		{Name: "index", Value: bson.M{
+			"keyPattern":         bson.M{key: 1},
+			"expireAfterSeconds": int(ttl / time.Second),
+		}},
+	}, nil)
+}
+
+// SetLogger ...
+func (c *DBCache) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+func (c *DBCache) log() Logger {
+	if c.logger == nil {
+		return DefaultLogger
+	}
+	return c.logger
+}
+
+func (c *DBCache) checkReady() error {
+	if !c.ready {
+		return &Error{Type: "NOT_INITED", Message: "Require to init database before using cache."}
+	}
+	return nil
+}
+
+// Get value of k from L1, else from L2. Return NOT_FOUND error if both miss.
+func (c *DBCache) Get(k string) (interface{}, error) {
+	return c.GetOrLoad(k, nil)
+}
+
+// GetOrLoad value of k from L1, else from L2, else from loader which result is written to both tiers.
+// Concurrent calls of a replica for the same key share one L2 read & loader call.
+func (c *DBCache) GetOrLoad(k string, loader Loader[string, interface{}]) (interface{}, error) {
+	if err := c.checkReady(); err != nil {
+		return nil, err
+	}
+	return c.L1.GetOrLoad(k, func(k string) (interface{}, error) {
+		v, found, err := c.getL2(k)
+		if found || loader == nil {
+			if !found && err == nil {
+				err = &Error{Type: "NOT_FOUND", Message: "Not found cache key " + k + "."}
+			}
+			return v, err
+		}
+
+		v, err = loader(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.putL2(k, v); err != nil {
+			c.log().Warn("Write cache entry failed", F("collection", c.ColName), F("key", k), F("error", err.Error()))
+		}
+		return v, nil
+	})
+}
+
+// Put write v to both tiers & tell other replicas to drop their L1 copy
+func (c *DBCache) Put(k string, v interface{}) error {
+	if err := c.checkReady(); err != nil {
+		return err
+	}
+	if err := c.putL2(k, v); err != nil {
+		return err
+	}
+	c.L1.Put(k, v)
+	return c.invalidate(k)
+}
+
+// Remove delete k from both tiers & tell other replicas to drop their L1 copy
+func (c *DBCache) Remove(k string) (err error) {
+	if err := c.checkReady(); err != nil {
+		return err
+	}
+	c.L1.Remove(k)
+
+	span := c.entryDB.startSpan("RemoveCacheEntry")
+	defer func() { span.RecordError(err).End() }()
+
+	s := c.entryDB.GetFreshSession()
+	defer s.Close()
+	col, err := c.entryDB.GetColWith(s)
+	if err != nil {
+		return err
+	}
+	err = col.RemoveId(k)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return c.invalidate(k)
+}
+
+// getL2 read k, found is false when it is missing or expired
+func (c *DBCache) getL2(k string) (v interface{}, found bool, err error) {
+	resp := c.entryDB.QueryOne(bson.M{
+		"_id":               k,
+		"last_updated_time": bson.M{"$gt": time.Now().Add(-c.TTL)},
+	})
+	switch resp.Status {
+	case DbStatus.Ok:
+	case DbStatus.NotFound:
+		return nil, false, nil
+	default:
+		return nil, false, &Error{Type: resp.ErrorCode, Message: resp.Message}
+	}
+
+	entry := resp.Data.([]*dbCacheEntry)[0]
+	obj := reflect.New(reflect.TypeOf(c.TemplateObject))
+	if err := entry.Value.Unmarshal(obj.Interface()); err != nil {
+		return nil, false, &Error{Type: "MAP_OBJECT_FAILED", Message: "Decode cache entry " + k + " failed: " + err.Error()}
+	}
+	return obj.Elem().Interface(), true, nil
+}
+
+func (c *DBCache) putL2(k string, v interface{}) error {
+	resp := c.entryDB.UpsertOne(bson.M{"_id": k}, bson.M{"value": v})
+	if resp.Status != DbStatus.Ok {
+		return &Error{Type: resp.ErrorCode, Message: resp.Message}
+	}
+	return nil
+}
+
+func (c *DBCache) invalidate(k string) error {
+	resp := c.eventDB.Create(&dbCacheInvalidation{Key: k, Owner: c.owner})
+	if resp.Status != DbStatus.Ok {
+		return &Error{Type: "INVALIDATE_FAILED", Message: resp.Message}
+	}
+	return nil
+}
+
+// Start apply invalidations of other replicas every SyncInterval, so DBCache can be registered in App
+func (c *DBCache) Start(ctx context.Context) error {
+	if err := c.checkReady(); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.done != nil {
+		return &Error{Type: "ALREADY_STARTED", Message: "Cache sync is already started."}
+	}
+
+	syncCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.since = time.Now()
+	c.seen = map[bson.ObjectId]time.Time{}
+	go c.syncLoop(syncCtx, c.done)
+	return nil
+}
+
+// Stop stop applying invalidations, L1 is cleaned as it can not be trusted anymore
+func (c *DBCache) Stop(ctx context.Context) error {
+	c.lock.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel, c.done = nil, nil
+	c.lock.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.L1.Cleanup()
+	return nil
+}
+
+func (c *DBCache) syncLoop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(c.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.sync(); err != nil {
+				c.log().Warn("Sync cache invalidations failed", F("collection", c.ColName), F("error", err.Error()))
+			}
+		}
+	}
+}
+
+// sync drop L1 keys written by other replicas since the last sync
+func (c *DBCache) sync() (err error) {
+	span := c.eventDB.startSpan("SyncCacheInvalidations")
+	defer func() { span.RecordError(err).End() }()
+
+	s := c.eventDB.GetFreshSession()
+	defer s.Close()
+	col, err := c.eventDB.GetColWith(s)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	from := c.since.Add(-dbCacheSkew)
+	var events []*dbCacheInvalidation
+	err = col.Find(bson.M{
+		"created_time": bson.M{"$gt": from},
+		"owner":        bson.M{"$ne": c.owner},
+	}).Limit(dbCacheSyncLimit).All(&events)
+	if err != nil {
+		// since is kept, so missed events are read next time
+		return err
+	}
+	c.since = now
+	c.apply(events, now, from)
+	return nil
+}
+
+// apply drop L1 keys of events not applied yet, events are those created after from, read at now.
+// Events stay in seen while a later sync may read them again.
+func (c *DBCache) apply(events []*dbCacheInvalidation, now time.Time, from time.Time) {
+	if len(events) >= dbCacheSyncLimit {
+		c.L1.Cleanup()
+	}
+	for _, e := range events {
+		if _, ok := c.seen[e.ID]; ok {
+			continue
+		}
+		c.seen[e.ID] = now
+		c.L1.Remove(e.Key)
+	}
+	for id, at := range c.seen {
+		if at.Before(from) {
+			delete(c.seen, id)
+		}
+	}
+}
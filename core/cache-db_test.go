@@ -0,0 +1,66 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+func testDBCache() *DBCache {
+	return &DBCache{L1: NewLCache(10, 60), seen: map[bson.ObjectId]time.Time{}}
+}
+
+func invalidation(key string) *dbCacheInvalidation {
+	return &dbCacheInvalidation{ID: bson.NewObjectId(), Key: key}
+}
+
+func TestDBCacheApply(t *testing.T) {
+	c := testDBCache()
+	c.L1.Put("a", 1)
+	c.L1.Put("b", 2)
+	t0 := time.Now()
+	event := invalidation("a")
+
+	c.apply([]*dbCacheInvalidation{event}, t0, t0.Add(-dbCacheSkew))
+	if _, ok := c.L1.Get("a"); ok {
+		t.Fatal("invalidated key kept in L1")
+	}
+	if _, ok := c.L1.Get("b"); !ok {
+		t.Fatal("other key dropped from L1")
+	}
+
+	// read again within the skew, a value written since is kept
+	c.L1.Put("a", 3)
+	t1 := t0.Add(time.Second)
+	c.apply([]*dbCacheInvalidation{event}, t1, t0.Add(-dbCacheSkew))
+	if v, ok := c.L1.Get("a"); !ok || v != 3 {
+		t.Fatalf("L1.Get(a) = %v, %v after an event applied twice, want 3", v, ok)
+	}
+	if _, ok := c.seen[event.ID]; !ok {
+		t.Fatal("event forgotten while it can be read again")
+	}
+
+	// out of the skew, the event can't be read anymore
+	c.apply(nil, t0.Add(2*dbCacheSkew), t0.Add(time.Millisecond))
+	if len(c.seen) != 0 {
+		t.Fatalf("seen = %v, want events older than the skew dropped", c.seen)
+	}
+}
+
+func TestDBCacheApplyOverLimit(t *testing.T) {
+	c := testDBCache()
+	c.L1.Put("other", 1)
+	events := make([]*dbCacheInvalidation, dbCacheSyncLimit)
+	for i := range events {
+		events[i] = invalidation("a")
+	}
+	now := time.Now()
+	c.apply(events, now, now.Add(-dbCacheSkew))
+	if _, ok := c.L1.Get("other"); ok {
+		t.Fatal("L1 kept after too many invalidations")
+	}
+	if len(c.seen) != dbCacheSyncLimit {
+		t.Fatalf("len(seen) = %d, want %d", len(c.seen), dbCacheSyncLimit)
+	}
+}
@@ -0,0 +1,365 @@
+package core
+
+// EvictionPolicy how Cache picks the item to drop when it is full
+type EvictionPolicy string
+
+// Eviction policies
+const (
+	// EvictLRU drop least recently used item
+	EvictLRU EvictionPolicy = "LRU"
+	// EvictLFU drop least frequently used item, least recently used among equals
+	EvictLFU EvictionPolicy = "LFU"
+	// EvictTinyLFU W-TinyLFU: small LRU window in front of a segmented LRU,
+	// new items only replace old ones which are estimated to be used less often
+	EvictTinyLFU EvictionPolicy = "TINYLFU"
+)
+
+// evictor keeps eviction order of cache items, every operation is O(1).
+// Caller holds the cache lock.
+type evictor[K comparable, V any] interface {
+	push(it *cacheItem[K, V])
+	touch(it *cacheItem[K, V])
+	remove(it *cacheItem[K, V])
+	// evict detach & return the item to drop, nil if empty
+	evict() *cacheItem[K, V]
+	reset()
+}
+
+func newEvictor[K comparable, V any](policy EvictionPolicy, capacity int) evictor[K, V] {
+	switch policy {
+	case EvictLFU:
+		return newLFUEvictor[K, V]()
+	case EvictTinyLFU:
+		return newTinyLFUEvictor[K, V](capacity)
+	}
+	return newLRUEvictor[K, V]()
+}
+
+// itemList intrusive doubly linked list of cache items, front is most recent
+type itemList[K comparable, V any] struct {
+	root cacheItem[K, V]
+	len  int
+}
+
+func (l *itemList[K, V]) init() *itemList[K, V] {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.len = 0
+	return l
+}
+
+func (l *itemList[K, V]) pushFront(it *cacheItem[K, V]) {
+	it.prev = &l.root
+	it.next = l.root.next
+	l.root.next.prev = it
+	l.root.next = it
+	l.len++
+}
+
+func (l *itemList[K, V]) remove(it *cacheItem[K, V]) {
+	it.prev.next = it.next
+	it.next.prev = it.prev
+	it.prev, it.next = nil, nil
+	l.len--
+}
+
+func (l *itemList[K, V]) moveToFront(it *cacheItem[K, V]) {
+	if l.root.next == it {
+		return
+	}
+	l.remove(it)
+	l.pushFront(it)
+}
+
+func (l *itemList[K, V]) front() *cacheItem[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+func (l *itemList[K, V]) back() *cacheItem[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// lruEvictor ...
+type lruEvictor[K comparable, V any] struct {
+	items itemList[K, V]
+}
+
+func newLRUEvictor[K comparable, V any]() *lruEvictor[K, V] {
+	e := &lruEvictor[K, V]{}
+	e.items.init()
+	return e
+}
+
+func (e *lruEvictor[K, V]) push(it *cacheItem[K, V])   { e.items.pushFront(it) }
+func (e *lruEvictor[K, V]) touch(it *cacheItem[K, V])  { e.items.moveToFront(it) }
+func (e *lruEvictor[K, V]) remove(it *cacheItem[K, V]) { e.items.remove(it) }
+func (e *lruEvictor[K, V]) reset()                     { e.items.init() }
+
+func (e *lruEvictor[K, V]) evict() *cacheItem[K, V] {
+	it := e.items.back()
+	if it != nil {
+		e.items.remove(it)
+	}
+	return it
+}
+
+// lfuBucket items having the same use count
+type lfuBucket[K comparable, V any] struct {
+	freq       int
+	items      itemList[K, V]
+	prev, next *lfuBucket[K, V]
+}
+
+// lfuEvictor buckets ordered by ascending use count, constant time LFU
+type lfuEvictor[K comparable, V any] struct {
+	head lfuBucket[K, V]
+}
+
+func newLFUEvictor[K comparable, V any]() *lfuEvictor[K, V] {
+	e := &lfuEvictor[K, V]{}
+	e.reset()
+	return e
+}
+
+func (e *lfuEvictor[K, V]) reset() {
+	e.head.next = &e.head
+	e.head.prev = &e.head
+}
+
+// bucketAfter bucket of freq right after b, created if missing
+func (e *lfuEvictor[K, V]) bucketAfter(b *lfuBucket[K, V], freq int) *lfuBucket[K, V] {
+	if b.next != &e.head && b.next.freq == freq {
+		return b.next
+	}
+	nb := &lfuBucket[K, V]{freq: freq, prev: b, next: b.next}
+	nb.items.init()
+	b.next.prev = nb
+	b.next = nb
+	return nb
+}
+
+func (e *lfuEvictor[K, V]) unlinkIfEmpty(b *lfuBucket[K, V]) {
+	if b.items.len == 0 && b != &e.head {
+		b.prev.next = b.next
+		b.next.prev = b.prev
+	}
+}
+
+func (e *lfuEvictor[K, V]) push(it *cacheItem[K, V]) {
+	b := e.bucketAfter(&e.head, 1)
+	b.items.pushFront(it)
+	it.bucket = b
+}
+
+func (e *lfuEvictor[K, V]) touch(it *cacheItem[K, V]) {
+	b := it.bucket
+	nb := e.bucketAfter(b, b.freq+1)
+	b.items.remove(it)
+	nb.items.pushFront(it)
+	it.bucket = nb
+	e.unlinkIfEmpty(b)
+}
+
+func (e *lfuEvictor[K, V]) remove(it *cacheItem[K, V]) {
+	b := it.bucket
+	b.items.remove(it)
+	it.bucket = nil
+	e.unlinkIfEmpty(b)
+}
+
+func (e *lfuEvictor[K, V]) evict() *cacheItem[K, V] {
+	b := e.head.next
+	if b == &e.head {
+		return nil
+	}
+	it := b.items.back()
+	e.remove(it)
+	return it
+}
+
+// segments of W-TinyLFU
+const (
+	segWindow uint8 = iota + 1
+	segProbation
+	segProtected
+)
+
+// tinyLFUEvictor W-TinyLFU: 1% window LRU, main space split into 20% probation & 80% protected.
+// Items leaving the window enter probation, on eviction the newest probation item competes
+// with the oldest one and the less frequent (by count-min sketch) is dropped.
+type tinyLFUEvictor[K comparable, V any] struct {
+	capacity     int
+	windowCap    int
+	protectedCap int
+	sketch       *cmSketch
+	window       itemList[K, V]
+	probation    itemList[K, V]
+	protected    itemList[K, V]
+}
+
+func newTinyLFUEvictor[K comparable, V any](capacity int) *tinyLFUEvictor[K, V] {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	windowCap := capacity / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	e := &tinyLFUEvictor[K, V]{
+		capacity:     capacity,
+		windowCap:    windowCap,
+		protectedCap: (capacity - windowCap) * 8 / 10,
+		sketch:       newCMSketch(capacity),
+	}
+	e.reset()
+	return e
+}
+
+func (e *tinyLFUEvictor[K, V]) reset() {
+	e.window.init()
+	e.probation.init()
+	e.protected.init()
+	e.sketch.clear()
+}
+
+func (e *tinyLFUEvictor[K, V]) list(seg uint8) *itemList[K, V] {
+	switch seg {
+	case segWindow:
+		return &e.window
+	case segProbation:
+		return &e.probation
+	}
+	return &e.protected
+}
+
+func (e *tinyLFUEvictor[K, V]) push(it *cacheItem[K, V]) {
+	e.sketch.add(it.hash)
+	it.segment = segWindow
+	e.window.pushFront(it)
+
+	// window overflow goes to probation
+	if e.window.len > e.windowCap {
+		c := e.window.back()
+		e.window.remove(c)
+		c.segment = segProbation
+		e.probation.pushFront(c)
+	}
+}
+
+func (e *tinyLFUEvictor[K, V]) touch(it *cacheItem[K, V]) {
+	e.sketch.add(it.hash)
+	switch it.segment {
+	case segWindow:
+		e.window.moveToFront(it)
+	case segProtected:
+		e.protected.moveToFront(it)
+	case segProbation:
+		e.probation.remove(it)
+		it.segment = segProtected
+		e.protected.pushFront(it)
+		if e.protected.len > e.protectedCap {
+			d := e.protected.back()
+			e.protected.remove(d)
+			d.segment = segProbation
+			e.probation.pushFront(d)
+		}
+	}
+}
+
+func (e *tinyLFUEvictor[K, V]) remove(it *cacheItem[K, V]) {
+	e.list(it.segment).remove(it)
+	it.segment = 0
+}
+
+func (e *tinyLFUEvictor[K, V]) evict() *cacheItem[K, V] {
+	victim := e.probation.back()
+	if victim == nil {
+		victim = e.protected.back()
+	}
+	if victim == nil {
+		victim = e.window.back()
+	}
+	if victim == nil {
+		return nil
+	}
+
+	// newly admitted item is dropped instead if it is not used more often than the victim
+	if victim.segment == segProbation {
+		candidate := e.probation.front()
+		if candidate != victim && e.sketch.estimate(candidate.hash) <= e.sketch.estimate(victim.hash) {
+			victim = candidate
+		}
+	}
+	e.remove(victim)
+	return victim
+}
+
+// cmSketch count-min sketch of 4 rows with counters saturating at 15,
+// all counters are halved every 10 * width additions so old popularity fades
+type cmSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCMSketch(capacity int) *cmSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &cmSketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch) index(hash uint64, row int) uint64 {
+	h1 := hash & 0xffffffff
+	h2 := hash >> 32
+	return (h1 + uint64(row)*h2 + uint64(row)) & s.mask
+}
+
+func (s *cmSketch) add(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *cmSketch) estimate(hash uint64) uint8 {
+	min := uint8(15)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(hash, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *cmSketch) clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+// expiryHeap min-heap of items by heapAt.
+// Extending an item's expiry (refresh on access) does not touch the heap, the item is pushed back
+// when it reaches the top, so cost is only paid by items which actually reach their deadline.
+type expiryHeap[K comparable, V any] []*cacheItem[K, V]
+
+func (h expiryHeap[K, V]) Len() int           { return len(h) }
+func (h expiryHeap[K, V]) Less(i, j int) bool { return h[i].heapAt < h[j].heapAt }
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expiryHeap[K, V]) Push(x interface{}) {
+	it := x.(*cacheItem[K, V])
+	it.heapIndex = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *expiryHeap[K, V]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.heapIndex = -1
+	*h = old[:n-1]
+	return it
+}
+
+// expired ...
+func (it *cacheItem[K, V]) expired(now int64) bool {
+	at := atomic.LoadInt64(&it.expireAt)
+	return at != 0 && at <= now
+}
+
+// schedule put item in the expiry heap according to its expireAt, caller holds the lock
+func (s *cacheShard[K, V]) schedule(it *cacheItem[K, V]) {
+	at := atomic.LoadInt64(&it.expireAt)
+	switch {
+	case at == 0:
+		s.unschedule(it)
+		return
+	case it.heapIndex < 0:
+		it.heapAt = at
+		heap.Push(&s.expiry, it)
+	case at < it.heapAt:
+		it.heapAt = at
+		heap.Fix(&s.expiry, it.heapIndex)
+	default:
+		// later expiry is handled lazily when the item reaches the top
+		return
+	}
+	s.owner.wakeBefore(it.heapAt)
+}
+
+// unschedule caller holds the lock
+func (s *cacheShard[K, V]) unschedule(it *cacheItem[K, V]) {
+	if it.heapIndex >= 0 {
+		heap.Remove(&s.expiry, it.heapIndex)
+	}
+}
+
+// expire remove items expired at now, return the next deadline or 0 if nothing to expire.
+// Caller holds the lock.
+func (s *cacheShard[K, V]) expire(now int64) int64 {
+	for len(s.expiry) > 0 {
+		top := s.expiry[0]
+		if top.heapAt > now {
+			return top.heapAt
+		}
+		if at := atomic.LoadInt64(&top.expireAt); at > now {
+			// refreshed since it was scheduled
+			top.heapAt = at
+			heap.Fix(&s.expiry, 0)
+			continue
+		}
+		s.delete(top, EvictedExpired)
+	}
+	return 0
+}
+
+// wakeBefore make expiry loop wake up at deadline if it sleeps longer
+func (c *Cache[K, V]) wakeBefore(deadline int64) {
+	for {
+		next := atomic.LoadInt64(&c.nextExpiry)
+		if deadline >= next {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&c.nextExpiry, next, deadline) {
+			notify(c.wake)
+			return
+		}
+	}
+}
+
+// expireAll remove expired items of all shards, return the earliest deadline left
+func (c *Cache[K, V]) expireAll(now int64) int64 {
+	// reset before the scan, so deadlines scheduled during it are merged instead of overwritten
+	atomic.StoreInt64(&c.nextExpiry, maxExpiry)
+	var next int64 = maxExpiry
+	for _, s := range c.shards {
+		s.lock.Lock()
+		n := s.expire(now)
+		s.unlock()
+		if n > 0 && n < next {
+			next = n
+		}
+	}
+	for {
+		cur := atomic.LoadInt64(&c.nextExpiry)
+		if cur <= next {
+			return cur
+		}
+		if atomic.CompareAndSwapInt64(&c.nextExpiry, cur, next) {
+			return next
+		}
+	}
+}
+
+// expireLoop sleep until the earliest deadline of all shards
+func (c *Cache[K, V]) expireLoop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.wake:
+		case <-c.closed:
+			return
+		}
+
+		next := c.expireAll(time.Now().UnixNano())
+
+		wait := time.Hour
+		if next != maxExpiry {
+			wait = time.Duration(next - time.Now().UnixNano())
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Close stop background expiry, afterward expired items are hidden from readers but not freed
+func (c *Cache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.negatives != nil {
+			c.negatives.Close()
+		}
+	})
+}
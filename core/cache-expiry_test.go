@@ -0,0 +1,93 @@
+package core
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor poll cond until it holds or timeout elapses
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return cond()
+}
+
+func TestExpireLoopRemovesExpired(t *testing.T) {
+	c := NewShardedCache[string, int](0, 20*time.Millisecond, false, 4)
+	defer c.Close()
+	c.PutWithTTL("keep", 1, 0)
+	for i := 0; i < 100; i++ {
+		c.Put(strconv.Itoa(i), i)
+	}
+	if !waitFor(time.Second, func() bool { return c.Len() == 1 }) {
+		t.Fatalf("Len() = %d after expiry, want 1", c.Len())
+	}
+	if _, ok := c.Get("keep"); !ok {
+		t.Fatal("item without ttl expired")
+	}
+	if got := c.Stats().Expirations; got != 100 {
+		t.Fatalf("Expirations = %d, want 100", got)
+	}
+}
+
+// TestExpireAllNoLostWakeup a deadline scheduled while the loop scans shards must not be dropped,
+// otherwise the loop sleeps for an hour and the item is freed late.
+func TestExpireAllNoLostWakeup(t *testing.T) {
+	c := NewShardedCache[int, int](0, 0, false, 1)
+	// drive expiry by hand
+	c.Close()
+	// OnEvict hooks run during the scan, after the shard lock is released
+	c.OnEvict(func(k int, v int, reason EvictionReason) {
+		if k == 1 {
+			c.PutWithTTL(2, 2, time.Hour)
+		}
+	})
+	c.PutWithTTL(1, 1, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	next := c.expireAll(time.Now().UnixNano())
+
+	h := c.hasher(2)
+	s := c.shard(h)
+	s.lock.RLock()
+	it, ok := s.m[2]
+	s.lock.RUnlock()
+	if !ok {
+		t.Fatal("item put during the scan is missing")
+	}
+	if next != it.heapAt {
+		t.Fatalf("next deadline = %d, want %d of the item put during the scan", next, it.heapAt)
+	}
+	if got := atomic.LoadInt64(&c.nextExpiry); got != it.heapAt {
+		t.Fatalf("nextExpiry = %d, want %d", got, it.heapAt)
+	}
+}
+
+func TestExpiryHeapOrder(t *testing.T) {
+	c := NewShardedCache[string, int](0, 0, false, 1)
+	defer c.Close()
+	s := c.shards[0]
+	now := time.Now().UnixNano()
+	s.lock.Lock()
+	for i, at := range []int64{50, 10, 40, 20, 30} {
+		s.put(strconv.Itoa(i), 0, i, time.Second, now-at, now-100)
+	}
+	// reschedule to the latest deadline
+	s.put("1", 0, 1, time.Second, now-5, now-100)
+	next := s.expire(now - 25)
+	got := len(s.m)
+	s.unlock()
+	if got != 2 {
+		t.Fatalf("%d items left after expiring 3 of them, want 2", got)
+	}
+	if next != now-20 {
+		t.Fatalf("next deadline = %d, want %d", next, now-20)
+	}
+}
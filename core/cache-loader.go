@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Loader load value of a key missing from the cache, e.g. from a RestClient or DBModel.QueryOne
+type Loader[K comparable, V any] func(k K) (V, error)
+
+// loadCall load in flight, shared by all callers of the same key
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	start int64
+}
+
+// SetStaleWhileRevalidate values older than staleAfter are still returned by GetOrLoad,
+// while a single background load replaces them. 0 disables it (default).
+// staleAfter should be shorter than the ttl, values are gone once they expire.
+func (c *Cache[K, V]) SetStaleWhileRevalidate(staleAfter time.Duration) *Cache[K, V] {
+	c.staleAfter = staleAfter
+	return c
+}
+
+// SetNegativeCache remember loader errors for ttl, GetOrLoad returns them without calling the loader.
+// match picks errors to remember (e.g. not found), nil means every error. ttl 0 disables it (default).
+func (c *Cache[K, V]) SetNegativeCache(ttl time.Duration, match func(err error) bool) *Cache[K, V] {
+	if c.negatives != nil {
+		c.negatives.Close()
+		c.negatives = nil
+	}
+	if ttl > 0 {
+		c.negatives = NewCache[K, error](c.maxItem, ttl, false).SetHasher(c.hasher)
+	}
+	c.negativeMatch = match
+	return c
+}
+
+// GetOrLoad get value of k, calling loader on a miss.
+// Concurrent calls for the same key share a single loader call.
+func (c *Cache[K, V]) GetOrLoad(k K, loader Loader[K, V]) (v V, err error) {
+	now := time.Now().UnixNano()
+	h := c.hasher(k)
+	s := c.shard(h)
+	v, updated, ok := s.get(k, now, c.refreshTTL)
+	if ok {
+		if c.staleAfter > 0 && now-updated >= int64(c.staleAfter) {
+			if call, leader := s.beginLoad(k, now); leader {
+				go c.finishLoad(s, k, h, call, loader, true)
+			}
+		}
+		return v, nil
+	}
+
+	if c.negatives != nil {
+		if err, ok := c.negatives.Get(k); ok {
+			return v, err
+		}
+	}
+
+	call, leader := s.beginLoad(k, now)
+	if leader {
+		c.finishLoad(s, k, h, call, loader, false)
+	} else {
+		<-call.done
+	}
+	return call.value, call.err
+}
+
+// beginLoad return the load in flight for k, leader is true if the caller must run it
+func (s *cacheShard[K, V]) beginLoad(k K, now int64) (call *loadCall[V], leader bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if call, ok := s.loads[k]; ok {
+		return call, false
+	}
+	call = &loadCall[V]{done: make(chan struct{}), start: now}
+	s.loads[k] = call
+	return call, true
+}
+
+// finishLoad run loader & store its result, background loads keep the current value & its ttl,
+// on error the current value is kept & counted in CacheStats.RevalidationErrors
+func (c *Cache[K, V]) finishLoad(s *cacheShard[K, V], k K, h uint64, call *loadCall[V], loader Loader[K, V], background bool) {
+	call.value, call.err = callLoader(k, loader)
+
+	if call.err != nil && background {
+		// the stale value is kept & served until it expires
+		atomic.AddInt64(&s.stats.revalidationErrors, 1)
+	}
+	if call.err != nil && !background && c.negatives != nil && (c.negativeMatch == nil || c.negativeMatch(call.err)) {
+		c.negatives.Put(k, call.err)
+	}
+
+	s.lock.Lock()
+	delete(s.loads, k)
+	if call.err == nil {
+		// a Put during the load wins over the loaded value
+		if it, ok := s.m[k]; !ok || it.updated <= call.start {
+			ttl := c.ttl
+			if ok && background {
+				// revalidation keeps the ttl given by PutWithTTL
+				ttl = it.ttl
+			}
+			s.drainReads()
+			now := time.Now().UnixNano()
+			s.put(k, h, call.value, ttl, expireAt(now, ttl), now)
+		}
+	}
+	s.unlock()
+	close(call.done)
+}
+
+func callLoader[K comparable, V any](k K, loader Loader[K, V]) (v V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Error{Type: "PANIC", Message: fmt.Sprint(r), Data: string(debug.Stack())}
+		}
+	}()
+	return loader(k)
+}
@@ -0,0 +1,267 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingLoader loader returning value once release is closed, calls counts loader calls
+type blockingLoader struct {
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+	value   int
+	err     error
+}
+
+func newBlockingLoader(value int, err error) *blockingLoader {
+	return &blockingLoader{started: make(chan struct{}, 100), release: make(chan struct{}), value: value, err: err}
+}
+
+func (l *blockingLoader) load(k string) (int, error) {
+	atomic.AddInt32(&l.calls, 1)
+	l.started <- struct{}{}
+	<-l.release
+	return l.value, l.err
+}
+
+func (l *blockingLoader) count() int {
+	return int(atomic.LoadInt32(&l.calls))
+}
+
+func TestGetOrLoadSingleflight(t *testing.T) {
+	for _, loadErr := range []error{nil, errors.New("backend down")} {
+		c := NewCache[string, int](0, 0, false)
+		l := newBlockingLoader(42, loadErr)
+
+		const n = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := c.GetOrLoad("k", l.load)
+				if err != loadErr || (err == nil && v != 42) {
+					errs <- errors.New("unexpected result")
+				}
+			}()
+		}
+		<-l.started
+		// let the other callers join the load in flight
+		time.Sleep(20 * time.Millisecond)
+		close(l.release)
+		wg.Wait()
+		close(errs)
+		c.Close()
+
+		for err := range errs {
+			t.Fatalf("loader error %v: %v", loadErr, err)
+		}
+		if loadErr == nil && l.count() != 1 {
+			t.Fatalf("loader ran %d times for %d concurrent callers, want 1", l.count(), n)
+		}
+		if loadErr != nil && l.count() >= n {
+			t.Fatalf("failing loader ran %d times for %d concurrent callers, want shared calls", l.count(), n)
+		}
+	}
+}
+
+func TestGetOrLoadStaleWhileRevalidate(t *testing.T) {
+	c := NewCache[string, int](0, time.Hour, false).SetStaleWhileRevalidate(10 * time.Millisecond)
+	defer c.Close()
+	c.Put("k", 1)
+	time.Sleep(20 * time.Millisecond)
+
+	l := newBlockingLoader(2, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// stale value is served while the background load runs
+			if v, err := c.GetOrLoad("k", l.load); err != nil || v != 1 {
+				t.Errorf("GetOrLoad() = %d, %v during revalidation, want stale 1", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	<-l.started
+	close(l.release)
+	if !waitFor(time.Second, func() bool { v, _ := c.Get("k"); return v == 2 }) {
+		t.Fatal("value was not revalidated")
+	}
+	if l.count() != 1 {
+		t.Fatalf("loader ran %d times, want a single background load", l.count())
+	}
+	if v, err := c.GetOrLoad("k", l.load); err != nil || v != 2 {
+		t.Fatalf("GetOrLoad() = %d, %v after revalidation, want fresh 2", v, err)
+	}
+}
+
+func TestGetOrLoadStaleKeptOnError(t *testing.T) {
+	c := NewCache[string, int](0, time.Hour, false).SetStaleWhileRevalidate(time.Millisecond)
+	defer c.Close()
+	c.Put("k", 1)
+	time.Sleep(5 * time.Millisecond)
+
+	l := newBlockingLoader(0, errors.New("backend down"))
+	close(l.release)
+	if v, err := c.GetOrLoad("k", l.load); err != nil || v != 1 {
+		t.Fatalf("GetOrLoad() = %d, %v, want stale 1", v, err)
+	}
+	<-l.started
+	if !waitFor(time.Second, func() bool { return c.shards[0].loadsLen() == 0 }) {
+		t.Fatal("background load did not finish")
+	}
+	if v, ok := c.Get("k"); !ok || v != 1 {
+		t.Fatalf("Get() = %d, %v after a failed background load, want 1", v, ok)
+	}
+	if n := c.Stats().RevalidationErrors; n != 1 {
+		t.Fatalf("Stats().RevalidationErrors = %d, want 1", n)
+	}
+}
+
+func TestGetOrLoadRevalidateKeepsTTL(t *testing.T) {
+	c := NewCache[string, int](0, time.Hour, false).SetStaleWhileRevalidate(time.Millisecond)
+	defer c.Close()
+	c.PutWithTTL("k", 1, time.Minute)
+	time.Sleep(5 * time.Millisecond)
+
+	l := newBlockingLoader(2, nil)
+	close(l.release)
+	c.GetOrLoad("k", l.load)
+	if !waitFor(time.Second, func() bool { v, _ := c.Get("k"); return v == 2 }) {
+		t.Fatal("value was not revalidated")
+	}
+	s := c.shard(c.hasher("k"))
+	s.lock.RLock()
+	ttl := s.m["k"].ttl
+	s.lock.RUnlock()
+	if ttl != time.Minute {
+		t.Fatalf("ttl = %s after revalidation, want the ttl of PutWithTTL", ttl)
+	}
+}
+
+func (s *cacheShard[K, V]) loadsLen() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.loads)
+}
+
+func TestGetOrLoadNegativeCache(t *testing.T) {
+	notFound := &Error{Type: "NOT_FOUND", Message: "Not found."}
+	down := &Error{Type: "DOWN", Message: "Backend down."}
+	c := NewCache[string, int](0, 0, false).SetNegativeCache(time.Hour, func(err error) bool {
+		e, ok := err.(*Error)
+		return ok && e.Type == "NOT_FOUND"
+	})
+	defer c.Close()
+
+	var calls int32
+	loader := func(err error) Loader[string, int] {
+		return func(k string) (int, error) {
+			atomic.AddInt32(&calls, 1)
+			return 0, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.GetOrLoad("missing", loader(notFound))
+		}()
+	}
+	wg.Wait()
+	// concurrent callers may share several loads, afterward the error is remembered
+	before := atomic.LoadInt32(&calls)
+	for i := 0; i < 5; i++ {
+		if _, err := c.GetOrLoad("missing", loader(notFound)); err != notFound {
+			t.Fatalf("GetOrLoad() error = %v, want remembered %v", err, notFound)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != before {
+		t.Fatalf("loader ran %d more times for a remembered error, want 0", got-before)
+	}
+
+	// unmatched errors are not remembered
+	atomic.StoreInt32(&calls, 0)
+	for i := 0; i < 3; i++ {
+		c.GetOrLoad("flaky", loader(down))
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("loader ran %d times for an unmatched error, want 3", got)
+	}
+
+	// Remove forgets the error
+	c.Remove("missing")
+	v, err := c.GetOrLoad("missing", func(k string) (int, error) { return 7, nil })
+	if err != nil || v != 7 {
+		t.Fatalf("GetOrLoad() = %d, %v after Remove, want 7", v, err)
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	c := NewCache[string, int](0, 0, false)
+	defer c.Close()
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func(k string) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		panic("loader bug")
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = c.GetOrLoad("k", loader)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		e, ok := err.(*Error)
+		if !ok || e.Type != "PANIC" || e.Message != "loader bug" {
+			t.Fatalf("caller %d: error = %v, want PANIC loader bug", i, err)
+		}
+	}
+	if c.ContainsKey("k") {
+		t.Fatal("value of a panicking loader was cached")
+	}
+	// the panic does not leave the load in flight
+	v, err := c.GetOrLoad("k", func(k string) (int, error) { return 1, nil })
+	if err != nil || v != 1 {
+		t.Fatalf("GetOrLoad() = %d, %v after a panic, want 1", v, err)
+	}
+}
+
+func TestGetOrLoadPutWins(t *testing.T) {
+	c := NewCache[string, int](0, 0, false)
+	defer c.Close()
+	l := newBlockingLoader(1, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.GetOrLoad("k", l.load)
+	}()
+	<-l.started
+	c.Put("k", 2)
+	close(l.release)
+	<-done
+	if v, _ := c.Get("k"); v != 2 {
+		t.Fatalf("Get() = %d, want 2 put during the load", v)
+	}
+}
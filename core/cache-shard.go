@@ -0,0 +1,187 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// readBufferSize accesses recorded by readers under read lock, replayed to the evictor later.
+	// When the buffer is full accesses are dropped, eviction order is then approximate.
+	readBufferSize = 128
+	// readBufferDrain readers replay the buffer once it holds this many accesses
+	readBufferDrain = 64
+)
+
+// cacheShard part of Cache owning keys by hash, with its own lock, evictor & expiry heap
+type cacheShard[K comparable, V any] struct {
+	stats shardStats
+	// bytes estimated size of items, accessed atomically
+	bytes int64
+
+	owner    *Cache[K, V]
+	m        map[K]*cacheItem[K, V]
+	lock     sync.RWMutex
+	maxItem  int
+	maxBytes int64
+	sizer    Sizer[K, V]
+	evictor  evictor[K, V]
+	expiry   expiryHeap[K, V]
+	reads    chan *cacheItem[K, V]
+	loads    map[K]*loadCall[V]
+	tags     map[string]map[*cacheItem[K, V]]struct{}
+	// pending evicted items waiting for hooks, see unlock
+	pending []evictedItem[K, V]
+}
+
+func newCacheShard[K comparable, V any](owner *Cache[K, V], maxItem int, policy EvictionPolicy) *cacheShard[K, V] {
+	return &cacheShard[K, V]{
+		owner:   owner,
+		m:       make(map[K]*cacheItem[K, V], maxItem),
+		maxItem: maxItem,
+		evictor: newEvictor[K, V](policy, maxItem),
+		reads:   make(chan *cacheItem[K, V], readBufferSize),
+		loads:   map[K]*loadCall[V]{},
+		tags:    map[string]map[*cacheItem[K, V]]struct{}{},
+	}
+}
+
+// get return value & last put time of live item under read lock, accesses are recorded for the evictor
+func (s *cacheShard[K, V]) get(k K, now int64, refresh bool) (v V, updated int64, ok bool) {
+	s.lock.RLock()
+	it, ok := s.m[k]
+	if ok && it.expired(now) {
+		// removed by the expiry loop
+		ok = false
+	}
+	if ok {
+		v = it.value
+		updated = it.updated
+		if refresh && it.ttl > 0 {
+			atomic.StoreInt64(&it.expireAt, now+int64(it.ttl))
+		}
+	}
+	s.lock.RUnlock()
+
+	if ok {
+		atomic.AddInt64(&s.stats.hits, 1)
+		s.recordRead(it)
+	} else {
+		atomic.AddInt64(&s.stats.misses, 1)
+	}
+	return
+}
+
+func (s *cacheShard[K, V]) recordRead(it *cacheItem[K, V]) {
+	select {
+	case s.reads <- it:
+	default:
+	}
+	if len(s.reads) >= readBufferDrain {
+		s.lock.Lock()
+		s.drainReads()
+		s.lock.Unlock()
+	}
+}
+
+// drainReads replay recorded accesses, caller holds the lock
+func (s *cacheShard[K, V]) drainReads() {
+	for {
+		select {
+		case it := <-s.reads:
+			// skip items removed since they were read
+			if s.m[it.key] == it {
+				s.evictor.touch(it)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// put insert or replace item expiring at (unix nano, 0 means never), caller holds the lock
+func (s *cacheShard[K, V]) put(k K, hash uint64, v V, ttl time.Duration, at int64, now int64) {
+	size := s.size(k, v)
+	it, ok := s.m[k]
+	if s.maxBytes > 0 && size > s.maxBytes {
+		// never fits, other items are kept
+		if ok {
+			s.delete(it, EvictedCapacity)
+		}
+		return
+	}
+	if ok {
+		old := it.value
+		it.value = v
+		s.evicted(it, old, EvictedReplaced)
+		s.evictor.touch(it)
+	} else {
+		it = &cacheItem[K, V]{key: k, hash: hash, value: v, heapIndex: -1}
+		s.m[k] = it
+		s.evictor.push(it)
+	}
+	s.addBytes(size - it.size)
+	it.size = size
+	it.ttl = ttl
+	it.updated = now
+	atomic.StoreInt64(&it.expireAt, at)
+	s.schedule(it)
+	s.enforceCapacity()
+}
+
+// enforceCapacity evict items until maxItem & maxBytes are respected, caller holds the lock
+func (s *cacheShard[K, V]) enforceCapacity() {
+	for (s.maxItem > 0 && len(s.m) > s.maxItem) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		victim := s.evictor.evict()
+		if victim == nil {
+			return
+		}
+		s.unschedule(victim)
+		delete(s.m, victim.key)
+		s.untag(victim)
+		s.addBytes(-victim.size)
+		s.evicted(victim, victim.value, EvictedCapacity)
+	}
+}
+
+// delete remove item from map, evictor & expiry heap, caller holds the lock
+func (s *cacheShard[K, V]) delete(it *cacheItem[K, V], reason EvictionReason) {
+	s.evictor.remove(it)
+	s.unschedule(it)
+	delete(s.m, it.key)
+	s.untag(it)
+	s.addBytes(-it.size)
+	s.evicted(it, it.value, reason)
+}
+
+// setPolicy rebuild eviction order with a new policy, caller holds the lock
+func (s *cacheShard[K, V]) setPolicy(policy EvictionPolicy) {
+	s.drainReads()
+	s.evictor = newEvictor[K, V](policy, s.maxItem)
+	for _, it := range s.m {
+		it.prev, it.next, it.bucket, it.segment = nil, nil, nil, 0
+		s.evictor.push(it)
+	}
+}
+
+// reset remove everything, caller holds the lock
+func (s *cacheShard[K, V]) reset() {
+	s.drainReads()
+	if len(s.owner.onEvict) > 0 {
+		for _, it := range s.m {
+			s.evicted(it, it.value, EvictedCleanup)
+		}
+	}
+	s.m = make(map[K]*cacheItem[K, V], s.maxItem)
+	s.evictor.reset()
+	s.expiry = nil
+	s.tags = map[string]map[*cacheItem[K, V]]struct{}{}
+	atomic.StoreInt64(&s.bytes, 0)
+}
+
+func (s *cacheShard[K, V]) len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.m)
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Sizer approximate memory (bytes) held by an item
+type Sizer[K comparable, V any] func(k K, v V) int64
+
+// SetMaxBytes evict items by policy once they hold more than maxBytes, as estimated by sizer.
+// maxBytes is split evenly between shards like maxItem, items larger than a shard budget are not stored.
+// sizer nil means DefaultSizer, it runs under the shard lock so it should be cheap.
+// 0 disables the budget (default). Safe to call while the cache is in use.
+func (c *Cache[K, V]) SetMaxBytes(maxBytes int64, sizer Sizer[K, V]) *Cache[K, V] {
+	if sizer == nil {
+		sizer = DefaultSizer[K, V]
+	}
+	if maxBytes <= 0 {
+		sizer = nil
+	}
+	n := int64(len(c.shards))
+	for _, s := range c.shards {
+		s.lock.Lock()
+		s.maxBytes = (maxBytes + n - 1) / n
+		s.sizer = sizer
+		var bytes int64
+		for _, it := range s.m {
+			it.size = s.size(it.key, it.value)
+			bytes += it.size
+		}
+		atomic.StoreInt64(&s.bytes, bytes)
+		s.enforceCapacity()
+		s.unlock()
+	}
+	return c
+}
+
+// Bytes estimated memory held by items, 0 if no budget is set
+func (c *Cache[K, V]) Bytes() int64 {
+	var n int64
+	for _, s := range c.shards {
+		n += atomic.LoadInt64(&s.bytes)
+	}
+	return n
+}
+
+// size estimated size of an item, 0 without byte budget, caller holds the lock
+func (s *cacheShard[K, V]) size(k K, v V) int64 {
+	if s.sizer == nil {
+		return 0
+	}
+	return s.sizer(k, v)
+}
+
+// addBytes caller holds the lock, readers without lock load bytes atomically
+func (s *cacheShard[K, V]) addBytes(delta int64) {
+	atomic.AddInt64(&s.bytes, delta)
+}
+
+// DefaultSizer item struct plus memory reachable from key & value: string data, slice arrays,
+// maps & pointed values, each counted once. Channels & functions count as a pointer.
+func DefaultSizer[K comparable, V any](k K, v V) int64 {
+	n := int64(unsafe.Sizeof(cacheItem[K, V]{}))
+	// values boxed in interface{}, as in LCache, also hold their box
+	if _, boxed := any(&v).(*interface{}); !boxed {
+		switch x := any(v).(type) {
+		case string:
+			return n + keySize(k) + int64(len(x))
+		case []byte:
+			return n + keySize(k) + int64(cap(x))
+		}
+	}
+	seen := map[uintptr]bool{}
+	return n + heapSize(reflect.ValueOf(&k).Elem(), seen) + heapSize(reflect.ValueOf(&v).Elem(), seen)
+}
+
+func keySize[K comparable](k K) int64 {
+	if s, ok := any(k).(string); ok {
+		return int64(len(s))
+	}
+	return heapSize(reflect.ValueOf(&k).Elem(), map[uintptr]bool{})
+}
+
+// heapSize bytes referenced by v, not counting v itself
+func heapSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return int64(v.Type().Elem().Size()) + heapSize(v.Elem(), seen)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		n := heapSize(e, seen)
+		if e.Kind() != reflect.Ptr {
+			// boxed value
+			n += int64(e.Type().Size())
+		}
+		return n
+
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		if !isFlat(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				n += heapSize(v.Index(i), seen)
+			}
+		}
+		return n
+
+	case reflect.Array:
+		var n int64
+		if !isFlat(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				n += heapSize(v.Index(i), seen)
+			}
+		}
+		return n
+
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += heapSize(v.Field(i), seen)
+		}
+		return n
+
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		t := v.Type()
+		// buckets are about half full
+		n := 2 * int64(v.Len()) * int64(t.Key().Size()+t.Elem().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			n += heapSize(iter.Key(), seen) + heapSize(iter.Value(), seen)
+		}
+		return n
+	}
+	return 0
+}
+
+// isFlat type holding no reference, its size is its whole memory
+func isFlat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isFlat(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isFlat(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
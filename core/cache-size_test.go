@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+type sizeNode struct {
+	next *sizeNode
+	pad  [16]byte
+}
+
+type sizePair struct {
+	a, b *[64]byte
+}
+
+func TestHeapSize(t *testing.T) {
+	shared := &[64]byte{}
+	n1, n2 := &sizeNode{}, &sizeNode{}
+	n1.next, n2.next = n2, n1
+	self := &sizeNode{}
+	self.next = self
+	x := 1
+	ints := make([]int, 2, 10)
+	nodeSize := int64(unsafe.Sizeof(sizeNode{}))
+	strSize := int64(unsafe.Sizeof(""))
+	intSize := int64(unsafe.Sizeof(0))
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want int64
+	}{
+		{"flat", 42, 0},
+		{"string", "abc", 3},
+		{"nil pointer", (*sizeNode)(nil), 0},
+		{"pointer", &x, intSize},
+		{"shared pointer counted once", sizePair{shared, shared}, 64},
+		{"distinct pointers", sizePair{shared, &[64]byte{}}, 128},
+		{"cycle", n1, 2 * nodeSize},
+		{"self reference", self, nodeSize},
+		{"slice capacity", ints, 10 * intSize},
+		{"slice of strings", []string{"a", "bc"}, 2*strSize + 3},
+		{"same slice twice", [][]int{ints, ints}, 2*int64(unsafe.Sizeof(ints)) + 10*intSize},
+		{"array of strings", [2]string{"a", "bc"}, 3},
+		{"nil map", map[string]int(nil), 0},
+		{"map", map[string]int{"ab": 1, "c": 2}, 2*2*(strSize+intSize) + 3},
+		{"boxed int", []interface{}{1}, int64(unsafe.Sizeof(interface{}(nil))) + intSize},
+		{"boxed string", []interface{}{"abc"}, int64(unsafe.Sizeof(interface{}(nil))) + strSize + 3},
+		{"boxed pointer", []interface{}{&x}, int64(unsafe.Sizeof(interface{}(nil))) + intSize},
+		{"nil interface", []interface{}{nil}, int64(unsafe.Sizeof(interface{}(nil)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := heapSize(reflect.ValueOf(tt.v), map[uintptr]bool{})
+			if got != tt.want {
+				t.Fatalf("heapSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultSizer(t *testing.T) {
+	item := int64(unsafe.Sizeof(cacheItem[string, interface{}]{}))
+	if got, want := DefaultSizer[string, interface{}]("key", "value"), item+3+int64(unsafe.Sizeof(""))+5; got != want {
+		t.Fatalf("DefaultSizer(string in interface) = %d, want %d", got, want)
+	}
+	if got, want := DefaultSizer[string, string]("key", "value"), int64(unsafe.Sizeof(cacheItem[string, string]{}))+8; got != want {
+		t.Fatalf("DefaultSizer(string) = %d, want %d", got, want)
+	}
+	b := make([]byte, 3, 100)
+	if got, want := DefaultSizer[string, []byte]("k", b), int64(unsafe.Sizeof(cacheItem[string, []byte]{}))+101; got != want {
+		t.Fatalf("DefaultSizer([]byte) = %d, want %d", got, want)
+	}
+	// pointer shared by key & value counted once
+	p := &[64]byte{}
+	if got, want := DefaultSizer[*[64]byte, *[64]byte](p, p), int64(unsafe.Sizeof(cacheItem[*[64]byte, *[64]byte]{}))+64; got != want {
+		t.Fatalf("DefaultSizer(shared key & value) = %d, want %d", got, want)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	sizer := func(k string, v string) int64 { return int64(len(v)) }
+	c := NewShardedCache[string, string](0, 0, false, 1).SetMaxBytes(100, sizer)
+	defer c.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		c.Put(k, strings.Repeat("x", 40))
+	}
+	if c.Len() != 2 || c.Bytes() != 80 {
+		t.Fatalf("Len() = %d & Bytes() = %d, want 2 items of 80 bytes", c.Len(), c.Bytes())
+	}
+	if c.ContainsKey("a") {
+		t.Fatal("least recently used item kept over the byte budget")
+	}
+
+	// replace counts the new size only
+	c.Put("b", "x")
+	if c.Bytes() != 41 {
+		t.Fatalf("Bytes() = %d after replace, want 41", c.Bytes())
+	}
+
+	// larger than the budget: not stored, a previous value is dropped, others are kept
+	c.Put("b", strings.Repeat("x", 101))
+	if c.ContainsKey("b") || !c.ContainsKey("c") || c.Bytes() != 40 {
+		t.Fatalf("oversized put: b kept %v, c kept %v, Bytes() = %d", c.ContainsKey("b"), c.ContainsKey("c"), c.Bytes())
+	}
+
+	c.Remove("c")
+	if c.Bytes() != 0 {
+		t.Fatalf("Bytes() = %d after Remove, want 0", c.Bytes())
+	}
+}
+
+func TestRestoreCountsStoredItems(t *testing.T) {
+	sizer := func(k string, v string) int64 { return int64(len(v)) }
+	src := NewCache[string, string](0, 0, false)
+	defer src.Close()
+	src.Put("small", "x")
+	src.Put("big", strings.Repeat("x", 200))
+	src.Put("other", "x")
+
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewShardedCache[string, string](0, 0, false, 1).SetMaxBytes(100, sizer)
+	defer dst.Close()
+	n, err := dst.LoadSnapshot(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || dst.Len() != 2 {
+		t.Fatalf("LoadSnapshot() = %d with Len() = %d, want 2 items stored, the oversized one dropped", n, dst.Len())
+	}
+	if dst.ContainsKey("big") {
+		t.Fatal("oversized item restored")
+	}
+}
+
+func TestSetMaxBytesWhileInUse(t *testing.T) {
+	sizer := func(k string, v string) int64 { return int64(len(v)) }
+	c := NewShardedCache[string, string](0, 0, false, 4)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				k := strconv.Itoa(i*1000 + n%100)
+				c.Put(k, "xxxx")
+				c.Get(k)
+			}
+		}(i)
+	}
+	c.SetMaxBytes(400, sizer)
+	close(stop)
+	wg.Wait()
+
+	// every item counted with the sizer, whether put before or after SetMaxBytes
+	if got, want := c.Bytes(), int64(4*c.Len()); got != want || got > 400 {
+		t.Fatalf("Bytes() = %d with Len() = %d, want %d within the budget", got, c.Len(), want)
+	}
+}
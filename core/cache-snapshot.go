@@ -0,0 +1,219 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/binhgo/foosee/util"
+)
+
+// CacheSnapshotEntry item of a cache snapshot
+type CacheSnapshotEntry[K comparable, V any] struct {
+	Key   K
+	Value V
+	// TTL used to refresh the item, 0 means never expire
+	TTL time.Duration
+	// ExpireAt unix nano, 0 means never expire
+	ExpireAt int64
+	Tags     []string
+}
+
+// CacheSerializer encode & decode cache snapshots, entries is a *[]CacheSnapshotEntry[K, V]
+type CacheSerializer interface {
+	Encode(w io.Writer, entries interface{}) error
+	Decode(r io.Reader, entries interface{}) error
+}
+
+// Cache serializers
+var (
+	// GobSerializer default, keeps value types. Concrete types stored in interface{} values,
+	// e.g. in LCache, must be registered with gob.Register.
+	GobSerializer CacheSerializer = gobSerializer{}
+	// JSONSerializer readable, interface{} values are decoded as maps, slices & float64
+	JSONSerializer CacheSerializer = jsonSerializer{}
+)
+
+type gobSerializer struct{}
+
+func (gobSerializer) Encode(w io.Writer, entries interface{}) error {
+	return gob.NewEncoder(w).Encode(entries)
+}
+
+func (gobSerializer) Decode(r io.Reader, entries interface{}) error {
+	return gob.NewDecoder(r).Decode(entries)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Encode(w io.Writer, entries interface{}) error {
+	b, err := util.ToJson(entries)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (jsonSerializer) Decode(r io.Reader, entries interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return util.FromJson(b, entries)
+}
+
+// Snapshot live items with their expiry
+func (c *Cache[K, V]) Snapshot() []CacheSnapshotEntry[K, V] {
+	now := time.Now().UnixNano()
+	entries := make([]CacheSnapshotEntry[K, V], 0, c.Len())
+	for _, s := range c.shards {
+		s.lock.RLock()
+		for _, it := range s.m {
+			if it.expired(now) {
+				continue
+			}
+			entries = append(entries, CacheSnapshotEntry[K, V]{
+				Key:      it.key,
+				Value:    it.value,
+				TTL:      it.ttl,
+				ExpireAt: atomic.LoadInt64(&it.expireAt),
+				Tags:     append([]string(nil), it.tags...),
+			})
+		}
+		s.lock.RUnlock()
+	}
+	return entries
+}
+
+// Restore put items of a snapshot keeping their expiry, expired ones are skipped.
+// Return number of items stored.
+func (c *Cache[K, V]) Restore(entries []CacheSnapshotEntry[K, V]) int {
+	now := time.Now().UnixNano()
+	n := 0
+	for _, e := range entries {
+		if e.ExpireAt != 0 && e.ExpireAt <= now {
+			continue
+		}
+		h := c.hasher(e.Key)
+		s := c.shard(h)
+		s.lock.Lock()
+		s.drainReads()
+		s.put(e.Key, h, e.Value, e.TTL, e.ExpireAt, now)
+		// items larger than the byte budget are dropped
+		if it, ok := s.m[e.Key]; ok {
+			s.tag(it, e.Tags)
+			n++
+		}
+		s.unlock()
+	}
+	return n
+}
+
+// SaveSnapshot write snapshot to w, serializer nil means GobSerializer
+func (c *Cache[K, V]) SaveSnapshot(w io.Writer, serializer CacheSerializer) error {
+	if serializer == nil {
+		serializer = GobSerializer
+	}
+	entries := c.Snapshot()
+	return serializer.Encode(w, &entries)
+}
+
+// LoadSnapshot restore snapshot written by SaveSnapshot, serializer nil means GobSerializer
+func (c *Cache[K, V]) LoadSnapshot(r io.Reader, serializer CacheSerializer) (int, error) {
+	if serializer == nil {
+		serializer = GobSerializer
+	}
+	var entries []CacheSnapshotEntry[K, V]
+	if err := serializer.Decode(r, &entries); err != nil {
+		return 0, err
+	}
+	return c.Restore(entries), nil
+}
+
+// SaveSnapshotFile write snapshot to a temporary file renamed to path, so path always holds a whole snapshot
+func (c *Cache[K, V]) SaveSnapshotFile(path string, serializer CacheSerializer) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	err = c.SaveSnapshot(w, serializer)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshotFile restore snapshot saved by SaveSnapshotFile, a missing file restores nothing
+func (c *Cache[K, V]) LoadSnapshotFile(path string, serializer CacheSerializer) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return c.LoadSnapshot(bufio.NewReader(f), serializer)
+}
+
+// CacheSnapshot Component restoring a cache from Path on Start & saving it on Stop,
+// register it in App so caches start warm after a deploy
+type CacheSnapshot[K comparable, V any] struct {
+	Cache      *Cache[K, V]
+	Path       string
+	Serializer CacheSerializer
+	logger     Logger
+}
+
+// NewCacheSnapshot serializer nil means GobSerializer
+func NewCacheSnapshot[K comparable, V any](cache *Cache[K, V], path string, serializer CacheSerializer) *CacheSnapshot[K, V] {
+	return &CacheSnapshot[K, V]{Cache: cache, Path: path, Serializer: serializer}
+}
+
+// SetLogger ...
+func (p *CacheSnapshot[K, V]) SetLogger(logger Logger) *CacheSnapshot[K, V] {
+	p.logger = logger
+	return p
+}
+
+func (p *CacheSnapshot[K, V]) log() Logger {
+	if p.logger == nil {
+		return DefaultLogger
+	}
+	return p.logger
+}
+
+// Start restore the cache, an unreadable snapshot is logged & the cache starts cold
+func (p *CacheSnapshot[K, V]) Start(ctx context.Context) error {
+	n, err := p.Cache.LoadSnapshotFile(p.Path, p.Serializer)
+	if err != nil {
+		p.log().Warn("Load cache snapshot failed", F("path", p.Path), F("error", err.Error()))
+		return nil
+	}
+	p.log().Info("Cache snapshot loaded", F("path", p.Path), F("items", n))
+	return nil
+}
+
+// Stop save the cache
+func (p *CacheSnapshot[K, V]) Stop(ctx context.Context) error {
+	return p.Cache.SaveSnapshotFile(p.Path, p.Serializer)
+}
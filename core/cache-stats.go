@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bufio"
+	"sync/atomic"
+)
+
+// EvictionReason why an item left the cache
+type EvictionReason string
+
+// Eviction reasons
+const (
+	// EvictedExpired ttl passed
+	EvictedExpired EvictionReason = "EXPIRED"
+	// EvictedCapacity dropped by the eviction policy to respect maxItem or the byte budget
+	EvictedCapacity EvictionReason = "CAPACITY"
+	// EvictedRemoved dropped by Remove
+	EvictedRemoved EvictionReason = "REMOVED"
+	// EvictedCleanup dropped by Cleanup
+	EvictedCleanup EvictionReason = "CLEANUP"
+	// EvictedReplaced old value overwritten by Put or a load
+	EvictedReplaced EvictionReason = "REPLACED"
+)
+
+// EvictHook called with key & value leaving the cache
+type EvictHook[K comparable, V any] func(k K, v V, reason EvictionReason)
+
+// CacheStats counters since the cache was created
+type CacheStats struct {
+	Size        int     `json:"size"`
+	Bytes       int64   `json:"bytes"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRatio    float64 `json:"hitRatio"`
+	Evictions   int64   `json:"evictions"`
+	Expirations int64   `json:"expirations"`
+	// RevalidationErrors failed background loads of stale values, see SetStaleWhileRevalidate
+	RevalidationErrors int64 `json:"revalidationErrors"`
+}
+
+// shardStats counters of a shard, updated atomically
+type shardStats struct {
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+	// revalidationErrors failed background loads
+	revalidationErrors int64
+}
+
+type evictedItem[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
+}
+
+// OnEvict add hook called for every item leaving the cache, must be called before the cache is used.
+// Hooks run outside of cache locks on the goroutine which removed the item
+// (the expiry goroutine for expired items), so they should not block.
+func (c *Cache[K, V]) OnEvict(hook EvictHook[K, V]) *Cache[K, V] {
+	c.onEvict = append(c.onEvict, hook)
+	return c
+}
+
+// Stats ...
+func (c *Cache[K, V]) Stats() CacheStats {
+	st := CacheStats{}
+	for _, s := range c.shards {
+		st.Size += s.len()
+		st.Bytes += atomic.LoadInt64(&s.bytes)
+		st.Hits += atomic.LoadInt64(&s.stats.hits)
+		st.Misses += atomic.LoadInt64(&s.stats.misses)
+		st.Evictions += atomic.LoadInt64(&s.stats.evictions)
+		st.Expirations += atomic.LoadInt64(&s.stats.expirations)
+		st.RevalidationErrors += atomic.LoadInt64(&s.stats.revalidationErrors)
+	}
+	if total := st.Hits + st.Misses; total > 0 {
+		st.HitRatio = float64(st.Hits) / float64(total)
+	}
+	return st
+}
+
+// evicted count item leaving the shard & queue it for hooks, caller holds the lock
+func (s *cacheShard[K, V]) evicted(it *cacheItem[K, V], value V, reason EvictionReason) {
+	switch reason {
+	case EvictedCapacity:
+		atomic.AddInt64(&s.stats.evictions, 1)
+	case EvictedExpired:
+		atomic.AddInt64(&s.stats.expirations, 1)
+	}
+	if len(s.owner.onEvict) > 0 {
+		s.pending = append(s.pending, evictedItem[K, V]{key: it.key, value: value, reason: reason})
+	}
+}
+
+// unlock release the write lock then run hooks of items evicted while it was held
+func (s *cacheShard[K, V]) unlock() {
+	pending := s.pending
+	s.pending = nil
+	s.lock.Unlock()
+	s.owner.runEvictHooks(pending)
+}
+
+func (c *Cache[K, V]) runEvictHooks(pending []evictedItem[K, V]) {
+	for _, e := range pending {
+		for _, hook := range c.onEvict {
+			hook(e.key, e.value, e.reason)
+		}
+	}
+}
+
+// cacheCollector export stats of caches registered in services
+type cacheCollector struct {
+	services *Services
+}
+
+func (m *cacheCollector) write(w *bufio.Writer) {
+	names := m.services.CacheNames()
+	stats := make([]CacheStats, len(names))
+	for i, name := range names {
+		if c := m.services.Cache(name); c != nil {
+			stats[i] = c.Stats()
+		}
+	}
+
+	metrics := []struct {
+		name  string
+		help  string
+		kind  string
+		value func(st CacheStats) float64
+	}{
+		{"foosee_cache_hits_total", "Number of cache hits.", "counter", func(st CacheStats) float64 { return float64(st.Hits) }},
+		{"foosee_cache_misses_total", "Number of cache misses.", "counter", func(st CacheStats) float64 { return float64(st.Misses) }},
+		{"foosee_cache_evictions_total", "Number of items evicted to respect cache capacity.", "counter", func(st CacheStats) float64 { return float64(st.Evictions) }},
+		{"foosee_cache_expirations_total", "Number of expired items removed.", "counter", func(st CacheStats) float64 { return float64(st.Expirations) }},
+		{"foosee_cache_revalidation_errors_total", "Number of failed background loads of stale items.", "counter", func(st CacheStats) float64 { return float64(st.RevalidationErrors) }},
+		{"foosee_cache_size", "Number of items in cache.", "gauge", func(st CacheStats) float64 { return float64(st.Size) }},
+		{"foosee_cache_bytes", "Estimated memory held by cache items, 0 without byte budget.", "gauge", func(st CacheStats) float64 { return float64(st.Bytes) }},
+	}
+	for _, metric := range metrics {
+		w.WriteString("# HELP " + metric.name + " " + metric.help + "\n")
+		w.WriteString("# TYPE " + metric.name + " " + metric.kind + "\n")
+		for i, name := range names {
+			w.WriteString(metric.name + `{cache="` + escapeLabel(name) + `"} ` + formatFloat(metric.value(stats[i])) + "\n")
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// PutWithTags put item with default ttl of the cache & add tags to it, e.g. "client:C1234".
+// Tags of a key are kept when its value is replaced, until the item leaves the cache.
+func (c *Cache[K, V]) PutWithTags(k K, v V, tags ...string) {
+	now := time.Now().UnixNano()
+	h := c.hasher(k)
+	s := c.shard(h)
+	s.lock.Lock()
+	s.drainReads()
+	s.put(k, h, v, c.ttl, expireAt(now, c.ttl), now)
+	if it, ok := s.m[k]; ok {
+		s.tag(it, tags)
+	}
+	s.unlock()
+}
+
+// Tag add tags to item k, return false if k is not in the cache
+func (c *Cache[K, V]) Tag(k K, tags ...string) bool {
+	s := c.shard(c.hasher(k))
+	s.lock.Lock()
+	defer s.unlock()
+	it, ok := s.m[k]
+	if !ok || it.expired(time.Now().UnixNano()) {
+		return false
+	}
+	s.tag(it, tags)
+	return true
+}
+
+// InvalidateTags remove items having any of tags, return number of removed items.
+// All shards are locked meanwhile, so no reader sees part of them removed.
+func (c *Cache[K, V]) InvalidateTags(tags ...string) int {
+	n := 0
+	c.lockAll()
+	for _, s := range c.shards {
+		for _, tag := range tags {
+			for it := range s.tags[tag] {
+				s.delete(it, EvictedRemoved)
+				n++
+			}
+		}
+	}
+	c.unlockAll()
+	return n
+}
+
+// InvalidatePrefix remove items whose key starts with prefix, return number of removed items.
+// Only for string keys, every item is scanned while all shards are locked.
+func (c *Cache[K, V]) InvalidatePrefix(prefix string) int {
+	if !c.stringKeys {
+		return 0
+	}
+	n := 0
+	c.lockAll()
+	for _, s := range c.shards {
+		for k, it := range s.m {
+			if strings.HasPrefix(*(*string)(unsafe.Pointer(&k)), prefix) {
+				s.delete(it, EvictedRemoved)
+				n++
+			}
+		}
+	}
+	c.unlockAll()
+	return n
+}
+
+// lockAll lock shards in order, the only place holding several shard locks
+func (c *Cache[K, V]) lockAll() {
+	for _, s := range c.shards {
+		s.lock.Lock()
+		s.drainReads()
+	}
+}
+
+// unlockAll release all shards then run hooks of items evicted meanwhile
+func (c *Cache[K, V]) unlockAll() {
+	var pending []evictedItem[K, V]
+	for _, s := range c.shards {
+		pending = append(pending, s.pending...)
+		s.pending = nil
+		s.lock.Unlock()
+	}
+	c.runEvictHooks(pending)
+}
+
+// tag index item by tags, caller holds the lock
+func (s *cacheShard[K, V]) tag(it *cacheItem[K, V], tags []string) {
+	for _, tag := range tags {
+		set := s.tags[tag]
+		if _, ok := set[it]; ok {
+			continue
+		}
+		if set == nil {
+			set = map[*cacheItem[K, V]]struct{}{}
+			s.tags[tag] = set
+		}
+		set[it] = struct{}{}
+		it.tags = append(it.tags, tag)
+	}
+}
+
+// untag drop item from tag index, caller holds the lock
+func (s *cacheShard[K, V]) untag(it *cacheItem[K, V]) {
+	for _, tag := range it.tags {
+		set := s.tags[tag]
+		delete(set, it)
+		if len(set) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+	it.tags = nil
+}
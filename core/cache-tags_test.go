@@ -0,0 +1,208 @@
+package core
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tagIndexSize number of (tag, item) pairs indexed by all shards
+func tagIndexSize[K comparable, V any](c *Cache[K, V]) int {
+	n := 0
+	c.lockAll()
+	for _, s := range c.shards {
+		for _, set := range s.tags {
+			n += len(set)
+		}
+	}
+	c.unlockAll()
+	return n
+}
+
+func TestInvalidateTags(t *testing.T) {
+	c := NewShardedCache[string, int](0, 0, false, 4)
+	defer c.Close()
+	for i := 0; i < 20; i++ {
+		tags := []string{"all"}
+		if i%2 == 0 {
+			tags = append(tags, "even")
+		}
+		c.PutWithTags(strconv.Itoa(i), i, tags...)
+	}
+	c.Put("untagged", 0)
+	c.Tag("untagged", "other")
+
+	// items having both tags are removed & counted once, while their sets are ranged over
+	if n := c.InvalidateTags("even", "all"); n != 20 {
+		t.Fatalf("InvalidateTags() = %d, want 20", n)
+	}
+	if c.Len() != 1 || !c.ContainsKey("untagged") {
+		t.Fatalf("Len() = %d after invalidation, want only the untagged item", c.Len())
+	}
+	if n := tagIndexSize(c); n != 1 {
+		t.Fatalf("tag index holds %d items, want 1", n)
+	}
+	if n := c.InvalidateTags("all", "missing"); n != 0 {
+		t.Fatalf("InvalidateTags() of removed tag = %d, want 0", n)
+	}
+	if c.Tag("0", "all") {
+		t.Fatal("Tag() of a removed key = true")
+	}
+}
+
+func TestInvalidatePrefix(t *testing.T) {
+	c := NewShardedCache[string, int](0, 0, false, 4)
+	defer c.Close()
+	for _, k := range []string{"client:1", "client:2", "client", "order:1"} {
+		c.PutWithTags(k, 0, "t")
+	}
+	if n := c.InvalidatePrefix("client:"); n != 2 {
+		t.Fatalf("InvalidatePrefix() = %d, want 2", n)
+	}
+	if c.Len() != 2 || tagIndexSize(c) != 2 {
+		t.Fatalf("Len() = %d & tag index of %d items, want 2", c.Len(), tagIndexSize(c))
+	}
+
+	ints := NewCache[int, int](0, 0, false)
+	defer ints.Close()
+	ints.Put(1, 1)
+	if n := ints.InvalidatePrefix("1"); n != 0 || ints.Len() != 1 {
+		t.Fatalf("InvalidatePrefix() of int keys = %d, want 0", n)
+	}
+}
+
+// TestInvalidateTagsAtomic once a reader misses one item of a tag, it must miss all of them,
+// though they are spread over all shards
+func TestInvalidateTagsAtomic(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		c := NewShardedCache[string, int](0, 0, false, 16)
+		keys := make([]string, 64)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+			c.PutWithTags(keys[i], i, "group")
+		}
+
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		errs := make(chan string, 8)
+		for r := 0; r < 8; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				<-start
+				gone := ""
+				for i := 0; i < 2000; i++ {
+					k := keys[(i+r*7)%len(keys)]
+					_, ok := c.Get(k)
+					if !ok && gone == "" {
+						gone = k
+					}
+					if ok && gone != "" {
+						errs <- k + " still cached after " + gone + " was invalidated"
+						return
+					}
+				}
+			}(r)
+		}
+		close(start)
+		c.InvalidateTags("group")
+		wg.Wait()
+		c.Close()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("round %d: %s", round, err)
+		}
+	}
+}
+
+func TestTagsOnReplace(t *testing.T) {
+	c := NewShardedCache[string, int](0, 0, false, 1)
+	defer c.Close()
+	c.PutWithTags("k", 1, "a")
+	// replace keeps tags without indexing the item twice
+	c.PutWithTags("k", 2, "a", "b")
+	c.Put("k", 3)
+	if n := tagIndexSize(c); n != 2 {
+		t.Fatalf("tag index holds %d items after replace, want 2", n)
+	}
+	var tags []string
+	for _, e := range c.Snapshot() {
+		tags = e.Tags
+	}
+	sort.Strings(tags)
+	if len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Fatalf("tags after replace = %v, want [a b]", tags)
+	}
+	if n := c.InvalidateTags("b"); n != 1 || c.Len() != 0 {
+		t.Fatalf("InvalidateTags() = %d with Len() = %d, want replaced item removed", n, c.Len())
+	}
+	if n := tagIndexSize(c); n != 0 {
+		t.Fatalf("tag index holds %d items, want 0", n)
+	}
+}
+
+func TestTagsCleanup(t *testing.T) {
+	tests := []struct {
+		name  string
+		leave func(c *Cache[string, int])
+	}{
+		{"remove", func(c *Cache[string, int]) { c.Remove("0") }},
+		{"evict", func(c *Cache[string, int]) { c.Put("new", 0) }},
+		{"cleanup", func(c *Cache[string, int]) { c.Cleanup() }},
+		{"expire", func(c *Cache[string, int]) {
+			c.PutWithTTL("0", 0, time.Millisecond)
+			waitFor(time.Second, func() bool { return c.Len() < 3 })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewShardedCache[string, int](3, 0, false, 1)
+			defer c.Close()
+			for i := 0; i < 3; i++ {
+				c.PutWithTags(strconv.Itoa(i), i, "t", "t"+strconv.Itoa(i))
+			}
+			tt.leave(c)
+
+			want := 0
+			for i := 0; i < 3; i++ {
+				if c.ContainsKey(strconv.Itoa(i)) {
+					want += 2
+				}
+			}
+			if want == 6 {
+				t.Fatal("no tagged item left the cache")
+			}
+			if n := tagIndexSize(c); n != want {
+				t.Fatalf("tag index holds %d items, want %d", n, want)
+			}
+			s := c.shards[0]
+			s.lock.RLock()
+			_, left := s.tags["t0"]
+			s.lock.RUnlock()
+			if left {
+				t.Fatal("empty tag set kept in the index")
+			}
+		})
+	}
+}
+
+func TestInvalidateTagsHooks(t *testing.T) {
+	c := NewShardedCache[string, int](0, 0, false, 4)
+	defer c.Close()
+	var removed []string
+	c.OnEvict(func(k string, v int, reason EvictionReason) {
+		// hooks run after all shards are unlocked
+		c.Len()
+		if reason == EvictedRemoved {
+			removed = append(removed, k)
+		}
+	})
+	for i := 0; i < 8; i++ {
+		c.PutWithTags(strconv.Itoa(i), i, "t")
+	}
+	if n := c.InvalidateTags("t"); n != 8 || len(removed) != 8 {
+		t.Fatalf("InvalidateTags() = %d with %d hooks run, want 8", n, len(removed))
+	}
+}
@@ -1,110 +1,292 @@
 package core
 
 import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"reflect"
 	"sync"
 	"time"
+	"unsafe"
 )
 
-type cacheItem struct {
-	value        interface{}
-	lastAccessed int64
+// maxExpiry deadline meaning "nothing scheduled"
+const maxExpiry = math.MaxInt64
+
+// defaultCacheShards shard count of caches created by NewCache & NewLCacheRefreshMode,
+// small caches keep one shard so maxItem stays exact
+const defaultCacheShards = 16
+
+type cacheItem[K comparable, V any] struct {
+	key   K
+	hash  uint64
+	value V
+	// ttl used to refresh expireAt, 0 means never expire
+	ttl time.Duration
+	// expireAt unix nano, 0 means never expire, accessed atomically
+	expireAt int64
+	// updated unix nano of the last put
+	updated int64
+	// size estimated by the sizer, 0 without byte budget
+	size int64
+	tags []string
+
+	// expiry heap position, owned by the shard
+	heapAt    int64
+	heapIndex int
+
+	// eviction order, owned by the evictor
+	prev, next *cacheItem[K, V]
+	bucket     *lfuBucket[K, V]
+	segment    uint8
 }
 
-// LCache ...
-type LCache struct {
-	m          map[string]*cacheItem
-	l          sync.Mutex
-	ttl        int64
+// Hasher hash of cache keys, picks the shard & feeds EvictTinyLFU.
+// Equal keys must have equal hashes.
+type Hasher[K comparable] func(k K) uint64
+
+// Cache typed in-memory cache split in shards, each shard has its own lock so concurrent
+// handlers rarely wait for each other. Reads only take a read lock.
+// Values are stored as V, so small values are not boxed in interfaces.
+type Cache[K comparable, V any] struct {
+	shards     []*cacheShard[K, V]
+	mask       uint64
+	ttl        time.Duration
 	maxItem    int
 	refreshTTL bool
+	hasher     Hasher[K]
+	stringKeys bool
+
+	// GetOrLoad options
+	staleAfter    time.Duration
+	negatives     *Cache[K, error]
+	negativeMatch func(err error) bool
+
+	onEvict []EvictHook[K, V]
+
+	// nextExpiry earliest deadline the expiry loop is sleeping for, accessed atomically
+	nextExpiry int64
+	wake       chan struct{}
+	closed     chan struct{}
+	closeOnce  sync.Once
 }
 
+// LCache cache of interface{} values by string key
+type LCache = Cache[string, interface{}]
+
 // NewLCache ...
-// maxItem: maximum item
-// ttl: time to live (second)
+// maxItem: maximum item, least recently used items are evicted beyond it, 0 means unbounded
+// ttl: time to live (second), 0 or less expires items after 1 second, use NewCache for items never expiring
 func NewLCache(maxItem int, ttl int) (m *LCache) {
 	m = NewLCacheRefreshMode(maxItem, ttl, true)
 	return
 }
 
 // NewLCacheRefreshMode ...
-// maxItem: maximum item
-// ttl: time to live (second)
+// maxItem: maximum item, least recently used items are evicted beyond it, 0 means unbounded
+// ttl: time to live (second), 0 or less expires items after 1 second, use NewCache for items never expiring
 // refreshTTL : if refreshTTL = true, when someone access item, ttl of item will be refresh
+//
+// The cache runs a background goroutine for expiry until Close is called.
 func NewLCacheRefreshMode(maxItem int, ttl int, refreshTTL bool) (m *LCache) {
-	m = &LCache{m: make(map[string]*cacheItem, maxItem), maxItem: maxItem, refreshTTL: refreshTTL}
-	go func() {
-		for now := range time.Tick(time.Second) {
-			m.l.Lock()
-			for k, v := range m.m {
-				if now.Unix()-v.lastAccessed > int64(ttl) {
-					delete(m.m, k)
-				}
-			}
-			m.l.Unlock()
-		}
-	}()
-	return
+	return NewCache[string, interface{}](maxItem, lcacheTTL(ttl), refreshTTL)
 }
 
-// Len ...
-func (c *LCache) Len() int {
-	return len(c.m)
+// NewShardedLCache like NewLCacheRefreshMode with shards rounded up to a power of 2.
+// maxItem is split evenly between shards, so eviction starts when one shard is full.
+func NewShardedLCache(maxItem int, ttl int, refreshTTL bool, shards int) (m *LCache) {
+	return NewShardedCache[string, interface{}](maxItem, lcacheTTL(ttl), refreshTTL, shards)
 }
 
-// Put ...
-func (c *LCache) Put(k string, v interface{}) {
-	c.l.Lock()
-	it, ok := c.m[k]
-	if !ok {
-		it = &cacheItem{value: v}
-		c.m[k] = it
+// lcacheTTL LCache always dropped items of ttl 0 at the next second, this is kept for existing callers
+func lcacheTTL(ttl int) time.Duration {
+	if ttl <= 0 {
+		return time.Second
 	}
-	it.lastAccessed = time.Now().Unix()
-	c.l.Unlock()
+	return time.Duration(ttl) * time.Second
 }
 
-// Get ...
-func (c *LCache) Get(k string) (v interface{}, ok bool) {
-	c.l.Lock()
-	if it, okv := c.m[k]; okv {
-		ok = okv
-		v = it.value
-		if c.refreshTTL {
-			it.lastAccessed = time.Now().Unix()
+// NewCache typed cache, same semantics as NewLCacheRefreshMode with ttl as a duration,
+// except ttl 0 means never expire
+func NewCache[K comparable, V any](maxItem int, ttl time.Duration, refreshTTL bool) *Cache[K, V] {
+	shards := defaultCacheShards
+	if maxItem > 0 && maxItem < defaultCacheShards*64 {
+		shards = 1
+	}
+	return NewShardedCache[K, V](maxItem, ttl, refreshTTL, shards)
+}
+
+// NewShardedCache typed cache, same semantics as NewShardedLCache with ttl as a duration,
+// except ttl 0 means never expire
+func NewShardedCache[K comparable, V any](maxItem int, ttl time.Duration, refreshTTL bool, shards int) *Cache[K, V] {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	perShard := 0
+	if maxItem > 0 {
+		perShard = (maxItem + n - 1) / n
+	}
+
+	c := &Cache[K, V]{
+		shards:     make([]*cacheShard[K, V], n),
+		mask:       uint64(n - 1),
+		ttl:        ttl,
+		maxItem:    maxItem,
+		refreshTTL: refreshTTL,
+		hasher:     defaultHasher[K](),
+		stringKeys: isStringKey[K](),
+		nextExpiry: maxExpiry,
+		wake:       make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i] = newCacheShard(c, perShard, EvictLRU)
+	}
+	go c.expireLoop()
+	return c
+}
+
+// defaultHasher maphash over the key memory for strings, integers & bools,
+// other keys are hashed by their fmt representation (slow, use SetHasher instead)
+func defaultHasher[K comparable]() Hasher[K] {
+	seed := maphash.MakeSeed()
+	var zero K
+	t := reflect.TypeOf(zero)
+	if t == nil {
+		// interface key
+		return fmtHasher[K](seed)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return func(k K) uint64 {
+			var h maphash.Hash
+			h.SetSeed(seed)
+			h.WriteString(*(*string)(unsafe.Pointer(&k)))
+			return h.Sum64()
+		}
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		size := int(t.Size())
+		return func(k K) uint64 {
+			var h maphash.Hash
+			h.SetSeed(seed)
+			h.Write(unsafe.Slice((*byte)(unsafe.Pointer(&k)), size))
+			return h.Sum64()
 		}
 	}
-	c.l.Unlock()
+	return fmtHasher[K](seed)
+}
+
+func isStringKey[K comparable]() bool {
+	var zero K
+	t := reflect.TypeOf(zero)
+	return t != nil && t.Kind() == reflect.String
+}
+
+func fmtHasher[K comparable](seed maphash.Seed) Hasher[K] {
+	return func(k K) uint64 {
+		var h maphash.Hash
+		h.SetSeed(seed)
+		fmt.Fprintf(&h, "%#v", k)
+		return h.Sum64()
+	}
+}
+
+// SetHasher replace the default key hash, must be called before the cache is used.
+// Needed for keys whose equal values print differently, e.g. -0 & +0 floats.
+func (c *Cache[K, V]) SetHasher(hasher Hasher[K]) *Cache[K, V] {
+	c.hasher = hasher
+	if c.negatives != nil {
+		c.negatives.SetHasher(hasher)
+	}
+	return c
+}
+
+// SetEvictionPolicy policy used when the cache holds maxItem items, default EvictLRU
+func (c *Cache[K, V]) SetEvictionPolicy(policy EvictionPolicy) *Cache[K, V] {
+	for _, s := range c.shards {
+		s.lock.Lock()
+		s.setPolicy(policy)
+		s.lock.Unlock()
+	}
+	return c
+}
+
+func (c *Cache[K, V]) shard(hash uint64) *cacheShard[K, V] {
+	return c.shards[hash&c.mask]
+}
+
+// Len number of items, including expired items not yet removed
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.len()
+	}
+	return n
+}
+
+// Put put item with default ttl of the cache
+func (c *Cache[K, V]) Put(k K, v V) {
+	c.PutWithTTL(k, v, c.ttl)
+}
+
+// PutWithTTL put item living for ttl instead of the default ttl, 0 means never expire.
+// With refresh mode, access extends the item by its own ttl.
+func (c *Cache[K, V]) PutWithTTL(k K, v V, ttl time.Duration) {
+	now := time.Now().UnixNano()
+	h := c.hasher(k)
+	s := c.shard(h)
+	s.lock.Lock()
+	s.drainReads()
+	s.put(k, h, v, ttl, expireAt(now, ttl), now)
+	s.unlock()
+}
+
+func expireAt(now int64, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return now + int64(ttl)
+}
+
+// Get ...
+func (c *Cache[K, V]) Get(k K) (v V, ok bool) {
+	v, _, ok = c.shard(c.hasher(k)).get(k, time.Now().UnixNano(), c.refreshTTL)
 	return
 }
 
 // ContainsKey ...
-func (c *LCache) ContainsKey(k string) (ok bool) {
-	c.l.Lock()
-	it, ok := c.m[k]
-	if ok {
-		if c.refreshTTL {
-			it.lastAccessed = time.Now().Unix()
-		}
-	}
-	c.l.Unlock()
+func (c *Cache[K, V]) ContainsKey(k K) (ok bool) {
+	_, _, ok = c.shard(c.hasher(k)).get(k, time.Now().UnixNano(), c.refreshTTL)
 	return
 }
 
 // Remove ...
-func (c *LCache) Remove(k string) {
-	c.l.Lock()
-	if _, ok := c.m[k]; ok {
-		delete(c.m, k)
+func (c *Cache[K, V]) Remove(k K) {
+	s := c.shard(c.hasher(k))
+	s.lock.Lock()
+	s.drainReads()
+	if it, ok := s.m[k]; ok {
+		s.delete(it, EvictedRemoved)
+	}
+	s.unlock()
+	if c.negatives != nil {
+		c.negatives.Remove(k)
 	}
-	c.l.Unlock()
 	return
 }
 
 // Cleanup Remove all data
-func (c *LCache) Cleanup() {
-	c.l.Lock()
-	c.m = make(map[string]*cacheItem, c.maxItem)
-	c.l.Unlock()
+func (c *Cache[K, V]) Cleanup() {
+	for _, s := range c.shards {
+		s.lock.Lock()
+		s.reset()
+		s.unlock()
+	}
+	if c.negatives != nil {
+		c.negatives.Cleanup()
+	}
 	return
 }
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// evictorOp push, touch or remove key of an evictor test
+type evictorOp struct {
+	op  string
+	key string
+}
+
+func pushOp(k string) evictorOp   { return evictorOp{"push", k} }
+func touchOp(k string) evictorOp  { return evictorOp{"touch", k} }
+func removeOp(k string) evictorOp { return evictorOp{"remove", k} }
+
+// evictAll apply ops then drain the evictor, return keys in eviction order
+func evictAll(e evictor[string, int], ops []evictorOp) []string {
+	items := map[string]*cacheItem[string, int]{}
+	for _, op := range ops {
+		switch op.op {
+		case "push":
+			it := &cacheItem[string, int]{key: op.key, hash: uint64(len(items) + 1), heapIndex: -1}
+			items[op.key] = it
+			e.push(it)
+		case "touch":
+			e.touch(items[op.key])
+		case "remove":
+			e.remove(items[op.key])
+		}
+	}
+	var order []string
+	for it := e.evict(); it != nil; it = e.evict() {
+		order = append(order, it.key)
+	}
+	return order
+}
+
+func TestEvictorVictimOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		ops    []evictorOp
+		want   []string
+	}{
+		{"lru insertion order", EvictLRU,
+			[]evictorOp{pushOp("a"), pushOp("b"), pushOp("c")},
+			[]string{"a", "b", "c"}},
+		{"lru touched last", EvictLRU,
+			[]evictorOp{pushOp("a"), pushOp("b"), pushOp("c"), touchOp("a")},
+			[]string{"b", "c", "a"}},
+		{"lru removed skipped", EvictLRU,
+			[]evictorOp{pushOp("a"), pushOp("b"), pushOp("c"), removeOp("a")},
+			[]string{"b", "c"}},
+
+		{"lfu by use count", EvictLFU,
+			[]evictorOp{pushOp("a"), pushOp("b"), pushOp("c"), touchOp("a"), touchOp("a"), touchOp("b")},
+			[]string{"c", "b", "a"}},
+		{"lfu least recent among equals", EvictLFU,
+			[]evictorOp{pushOp("a"), pushOp("b"), touchOp("b"), touchOp("a")},
+			[]string{"b", "a"}},
+		{"lfu new item first", EvictLFU,
+			[]evictorOp{pushOp("a"), touchOp("a"), pushOp("b")},
+			[]string{"b", "a"}},
+		{"lfu removed bucket unlinked", EvictLFU,
+			[]evictorOp{pushOp("a"), pushOp("b"), touchOp("a"), removeOp("a"), pushOp("c")},
+			[]string{"b", "c"}},
+
+		// capacity 10: window of 1 item, protected of 7
+		{"tinylfu newcomer dropped on tie", EvictTinyLFU,
+			[]evictorOp{pushOp("a"), pushOp("b"), pushOp("c")},
+			[]string{"b", "a", "c"}},
+		{"tinylfu frequent newcomer admitted", EvictTinyLFU,
+			[]evictorOp{pushOp("a"), pushOp("b"), touchOp("b"), touchOp("b"), touchOp("b"), pushOp("c")},
+			[]string{"a", "b", "c"}},
+		{"tinylfu frequent old item kept", EvictTinyLFU,
+			[]evictorOp{pushOp("a"), touchOp("a"), touchOp("a"), touchOp("a"), pushOp("b"), pushOp("c")},
+			[]string{"b", "a", "c"}},
+		{"tinylfu protected after probation", EvictTinyLFU,
+			[]evictorOp{pushOp("a"), pushOp("b"), touchOp("a"), pushOp("c")},
+			[]string{"b", "a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evictAll(newEvictor[string, int](tt.policy, 10), tt.ops)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("eviction order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvictorReset(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictLRU, EvictLFU, EvictTinyLFU} {
+		e := newEvictor[string, int](policy, 10)
+		evictAll(e, []evictorOp{pushOp("a"), pushOp("b")})
+		e.push(&cacheItem[string, int]{key: "c", hash: 3})
+		e.reset()
+		if it := e.evict(); it != nil {
+			t.Fatalf("%s: evict() after reset = %q, want nil", policy, it.key)
+		}
+	}
+}
+
+func TestCMSketch(t *testing.T) {
+	tests := []struct {
+		name string
+		adds map[uint64]int
+		want map[uint64]uint8
+	}{
+		{"counts", map[uint64]int{1: 3, 2: 1}, map[uint64]uint8{1: 3, 2: 1, 3: 0}},
+		{"saturates at 15", map[uint64]int{1: 20}, map[uint64]uint8{1: 15}},
+		// width 16 halves counters every 160 additions
+		{"ages", map[uint64]int{1: 10, 2: 150}, map[uint64]uint8{1: 5, 2: 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCMSketch(10)
+			for _, h := range []uint64{1, 2} {
+				for i := 0; i < tt.adds[h]; i++ {
+					s.add(h)
+				}
+			}
+			for h, want := range tt.want {
+				if got := s.estimate(h); got != want {
+					t.Fatalf("estimate(%d) = %d, want %d", h, got, want)
+				}
+			}
+			s.clear()
+			for h := range tt.want {
+				if got := s.estimate(h); got != 0 {
+					t.Fatalf("estimate(%d) after clear = %d, want 0", h, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEnforceCapacity(t *testing.T) {
+	tests := []struct {
+		policy EvictionPolicy
+		// touched after insertion, before the cache overflows
+		touched []string
+		want    []string
+	}{
+		{EvictLRU, []string{"0"}, []string{"0", "3", "4"}},
+		{EvictLFU, []string{"1", "1", "2"}, []string{"1", "2", "4"}},
+		{EvictTinyLFU, nil, []string{"0", "1", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			c := NewShardedCache[string, int](3, 0, false, 1).SetEvictionPolicy(tt.policy)
+			// distinct sketch counters, so TinyLFU does not depend on the hash seed
+			c.SetHasher(func(k string) uint64 {
+				n, _ := strconv.Atoi(k)
+				return uint64(n + 1)
+			})
+			defer c.Close()
+			var evicted []string
+			c.OnEvict(func(k string, v int, reason EvictionReason) {
+				if reason != EvictedCapacity {
+					t.Errorf("evicted %q for %s, want %s", k, reason, EvictedCapacity)
+				}
+				evicted = append(evicted, k)
+			})
+			for i := 0; i < 3; i++ {
+				c.Put(strconv.Itoa(i), i)
+			}
+			for _, k := range tt.touched {
+				c.Get(k)
+			}
+			for i := 3; i < 5; i++ {
+				c.Put(strconv.Itoa(i), i)
+				if n := c.Len(); n > 3 {
+					t.Fatalf("Len() = %d after put, want at most 3", n)
+				}
+			}
+			var kept []string
+			for i := 0; i < 5; i++ {
+				if c.ContainsKey(strconv.Itoa(i)) {
+					kept = append(kept, strconv.Itoa(i))
+				}
+			}
+			if !reflect.DeepEqual(kept, tt.want) {
+				t.Fatalf("kept %v (evicted %v), want %v", kept, evicted, tt.want)
+			}
+			if got := c.Stats().Evictions; got != 2 {
+				t.Fatalf("Evictions = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestShardedCacheSplit(t *testing.T) {
+	tests := []struct {
+		maxItem  int
+		shards   int
+		n        int
+		perShard int
+	}{
+		{0, 16, 16, 0},
+		{5, 0, 1, 5},
+		{5, 1, 1, 5},
+		{10, 3, 4, 3},
+		{100, 16, 16, 7},
+		{1024, 16, 16, 64},
+		{1025, 16, 16, 65},
+	}
+	for _, tt := range tests {
+		c := NewShardedCache[string, int](tt.maxItem, 0, false, tt.shards)
+		c.Close()
+		if len(c.shards) != tt.n || c.mask != uint64(tt.n-1) {
+			t.Fatalf("NewShardedCache(%d, %d): %d shards & mask %d, want %d shards", tt.maxItem, tt.shards, len(c.shards), c.mask, tt.n)
+		}
+		for i, s := range c.shards {
+			if s.maxItem != tt.perShard {
+				t.Fatalf("NewShardedCache(%d, %d): shard %d holds %d items, want %d", tt.maxItem, tt.shards, i, s.maxItem, tt.perShard)
+			}
+		}
+	}
+}
+
+func TestNewCacheShards(t *testing.T) {
+	tests := []struct {
+		maxItem int
+		n       int
+	}{
+		{0, defaultCacheShards},
+		{1, 1},
+		{1023, 1},
+		{1024, defaultCacheShards},
+	}
+	for _, tt := range tests {
+		c := NewCache[string, int](tt.maxItem, 0, false)
+		c.Close()
+		if len(c.shards) != tt.n {
+			t.Fatalf("NewCache(%d): %d shards, want %d", tt.maxItem, len(c.shards), tt.n)
+		}
+	}
+}
+
+func TestShardSelection(t *testing.T) {
+	c := NewShardedCache[string, int](0, 0, false, 16)
+	defer c.Close()
+	for i := 0; i < 1000; i++ {
+		c.Put(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		h := c.hasher(k)
+		s := c.shard(h)
+		if s != c.shards[h&c.mask] {
+			t.Fatalf("shard(%d) is not shards[hash & mask]", h)
+		}
+		if _, ok := s.m[k]; !ok {
+			t.Fatalf("key %q is not in its shard", k)
+		}
+	}
+	for i, s := range c.shards {
+		if n := len(s.m); n == 0 || n > 1000/16*2 {
+			t.Fatalf("shard %d holds %d of 1000 keys, hash is not spread", i, n)
+		}
+	}
+}
+
+// checkHasher equal keys must hash equally, distinct keys are expected not to collide
+func checkHasher[K comparable](t *testing.T, keys []K, same func(k K) K) {
+	t.Helper()
+	h := defaultHasher[K]()
+	seen := map[uint64]K{}
+	for _, k := range keys {
+		v := h(k)
+		if h(same(k)) != v {
+			t.Fatalf("%T %#v: hash of an equal key differs", k, k)
+		}
+		if other, ok := seen[v]; ok {
+			t.Fatalf("%T %#v & %#v: same hash", k, k, other)
+		}
+		seen[v] = k
+	}
+}
+
+func TestDefaultHasher(t *testing.T) {
+	checkHasher(t, []string{"", "a", "b", "ab", "ba", "a\x00"}, func(k string) string {
+		// same value, other memory
+		return string([]byte(k))
+	})
+	checkHasher(t, []int{0, 1, -1, 256, 1 << 40}, func(k int) int { return k })
+	checkHasher(t, []int8{0, 1, -1, 127, -128}, func(k int8) int8 { return k })
+	checkHasher(t, []uint16{0, 1, 256, 65535}, func(k uint16) uint16 { return k })
+	checkHasher(t, []uint64{0, 1, 1 << 32, 1<<64 - 1}, func(k uint64) uint64 { return k })
+	checkHasher(t, []bool{false, true}, func(k bool) bool { return k })
+
+	type pair struct {
+		a string
+		b int
+	}
+	checkHasher(t, []pair{{"a", 1}, {"a", 2}, {"b", 1}}, func(k pair) pair {
+		return pair{string([]byte(k.a)), k.b}
+	})
+}
+
+func TestCacheKeyTypes(t *testing.T) {
+	c := NewCache[int8, string](0, 0, false)
+	defer c.Close()
+	for i := -128; i < 128; i++ {
+		c.Put(int8(i), strconv.Itoa(i))
+	}
+	for i := -128; i < 128; i++ {
+		if v, ok := c.Get(int8(i)); !ok || v != strconv.Itoa(i) {
+			t.Fatalf("Get(%d) = %q, %v", i, v, ok)
+		}
+	}
+	if c.Len() != 256 {
+		t.Fatalf("Len() = %d, want 256", c.Len())
+	}
+}
+
+func TestLCacheTTL(t *testing.T) {
+	tests := []struct {
+		ttl  int
+		want time.Duration
+	}{
+		// LCache always dropped items of ttl 0 after a second
+		{0, time.Second},
+		{-1, time.Second},
+		{60, time.Minute},
+	}
+	for _, tt := range tests {
+		c := NewLCache(10, tt.ttl)
+		c.Close()
+		if c.ttl != tt.want {
+			t.Fatalf("NewLCache(10, %d) ttl = %s, want %s", tt.ttl, c.ttl, tt.want)
+		}
+	}
+	c := NewCache[string, int](10, 0, false)
+	defer c.Close()
+	c.Put("a", 1)
+	c.shards[0].lock.RLock()
+	at := c.shards[0].m["a"].expireAt
+	c.shards[0].lock.RUnlock()
+	if at != 0 {
+		t.Fatalf("NewCache with ttl 0: item expires at %d, want never", at)
+	}
+}
@@ -0,0 +1,464 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binhgo/foosee/util"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigEnvPrefix prefix of environment variables overriding config files.
+//
+// Variable name is the upper-cased path of the field joined by "_", e.g:
+//
+//	FOOSEE_ENV=prod
+//	FOOSEE_SERVER_LISTEN=:8000
+//	FOOSEE_LOG_LEVEL=debug
+//	FOOSEE_DB_MAIN_ADDRESS=mongo-1:27017,mongo-2:27017   (list are comma-separated)
+//	FOOSEE_REST_PAYMENT_TIMEOUT=3s                       (or 3000, millisecond)
+//	FOOSEE_WORKERS_CLEANUP_PERIOD=60
+//
+// Entries of map sections (db, rest, workers) can only be overridden if they are declared in a file,
+// "-" in entry name is written "_".
+const ConfigEnvPrefix = "FOOSEE_"
+
+// Duration time.Duration read from "5s" / "100ms" string or number of millisecond
+type Duration time.Duration
+
+// UnmarshalJSON ...
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := util.FromJson(b, &v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+// UnmarshalYAML ...
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration) set(v interface{}) error {
+	switch t := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(t)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case int:
+		*d = Duration(time.Duration(t) * time.Millisecond)
+	case float64:
+		*d = Duration(time.Duration(t) * time.Millisecond)
+	default:
+		return &Error{Type: "INVALID_DURATION", Message: "Duration must be a string like \"5s\" or a number of millisecond."}
+	}
+	return nil
+}
+
+// ServerConfig ...
+type ServerConfig struct {
+	Listen        string `json:"listen" yaml:"listen"`
+	PollTimeout   int64  `json:"pollTimeout" yaml:"pollTimeout"`
+	HealthListen  string `json:"healthListen" yaml:"healthListen"`
+	MetricsListen string `json:"metricsListen" yaml:"metricsListen"`
+	AdminListen   string `json:"adminListen" yaml:"adminListen"`
+	AdminSecret   string `json:"adminSecret" yaml:"adminSecret"`
+}
+
+// LogConfig ...
+type LogConfig struct {
+	Level   string `json:"level" yaml:"level"`
+	JSON    bool   `json:"json" yaml:"json"`
+	Payload bool   `json:"payload" yaml:"payload"`
+}
+
+// RestClientConfig file form of APIClientConfiguration
+type RestClientConfig struct {
+	Address       string   `json:"address" yaml:"address"`
+	Protocol      string   `json:"protocol" yaml:"protocol"`
+	Timeout       Duration `json:"timeout" yaml:"timeout"`
+	MaxRetry      int      `json:"maxRetry" yaml:"maxRetry"`
+	WaitToRetry   Duration `json:"waitToRetry" yaml:"waitToRetry"`
+	LoggingCol    string   `json:"loggingCol" yaml:"loggingCol"`
+	MaxConnection int      `json:"maxConnection" yaml:"maxConnection"`
+}
+
+// APIClientConfiguration convert to config used by NewHTTPClient
+func (c RestClientConfig) APIClientConfiguration() *APIClientConfiguration {
+	return &APIClientConfiguration{
+		Address:       c.Address,
+		Protocol:      c.Protocol,
+		Timeout:       time.Duration(c.Timeout),
+		MaxRetry:      c.MaxRetry,
+		WaitToRetry:   time.Duration(c.WaitToRetry),
+		LoggingCol:    c.LoggingCol,
+		MaxConnection: c.MaxConnection,
+	}
+}
+
+// WorkerConfig ...
+type WorkerConfig struct {
+	Delay    int    `json:"delay" yaml:"delay"`
+	Period   int    `json:"period" yaml:"period"`
+	Cron     string `json:"cron" yaml:"cron"`
+	Timezone string `json:"timezone" yaml:"timezone"`
+	// Overlap SKIP, QUEUE or ALLOW
+	Overlap string   `json:"overlap" yaml:"overlap"`
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// MaxRetry retries of a failed run, waiting Backoff doubled each time up to MaxBackoff
+	MaxRetry   int      `json:"maxRetry" yaml:"maxRetry"`
+	Backoff    Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff Duration `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+// AppConfig ...
+type AppConfig struct {
+	Env     string                      `json:"env" yaml:"env"`
+	Version string                      `json:"version" yaml:"version"`
+	Server  ServerConfig                `json:"server" yaml:"server"`
+	Log     LogConfig                   `json:"log" yaml:"log"`
+	DB      map[string]DBConfiguration  `json:"db" yaml:"db"`
+	Rest    map[string]RestClientConfig `json:"rest" yaml:"rest"`
+	Workers map[string]WorkerConfig     `json:"workers" yaml:"workers"`
+}
+
+// Validate ...
+func (c *AppConfig) Validate() error {
+	problems := []string{}
+	switch strings.ToLower(c.Log.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		problems = append(problems, "log.level must be debug, info, warn or error")
+	}
+	if c.Server.AdminListen != "" && len(c.Server.AdminSecret) < minAdminSecret {
+		problems = append(problems, "server.adminSecret of at least "+strconv.Itoa(minAdminSecret)+" characters is required by server.adminListen")
+	}
+	for name, db := range c.DB {
+		if len(db.Address) == 0 {
+			problems = append(problems, "db."+name+".address is required")
+		}
+	}
+	for name, rc := range c.Rest {
+		if rc.Address == "" {
+			problems = append(problems, "rest."+name+".address is required")
+		}
+		if rc.Timeout < 0 || rc.WaitToRetry < 0 || rc.MaxRetry < 0 {
+			problems = append(problems, "rest."+name+" timeout, waitToRetry and maxRetry must not be negative")
+		}
+	}
+	for name, wk := range c.Workers {
+		if wk.Delay < 0 || wk.Period < 0 {
+			problems = append(problems, "workers."+name+" delay and period must not be negative")
+		}
+		if wk.Cron != "" {
+			if _, err := ParseCron(wk.Cron); err != nil {
+				problems = append(problems, "workers."+name+".cron: "+err.Error())
+			}
+		}
+		if wk.Timezone != "" {
+			if _, err := time.LoadLocation(wk.Timezone); err != nil {
+				problems = append(problems, "workers."+name+".timezone: "+err.Error())
+			}
+		}
+		switch OverlapPolicy(strings.ToUpper(wk.Overlap)) {
+		case "", OverlapSkip, OverlapQueue, OverlapAllow:
+		default:
+			problems = append(problems, "workers."+name+".overlap must be SKIP, QUEUE or ALLOW")
+		}
+		if wk.Timeout < 0 {
+			problems = append(problems, "workers."+name+".timeout must not be negative")
+		}
+		if wk.MaxRetry < 0 || wk.Backoff < 0 || wk.MaxBackoff < 0 {
+			problems = append(problems, "workers."+name+" maxRetry, backoff and maxBackoff must not be negative")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &Error{Type: "INVALID_CONFIG", Message: strings.Join(problems, "; "), Data: problems}
+	}
+	return nil
+}
+
+// LoadConfig read json / yaml files in order (later files override earlier ones),
+// apply FOOSEE_ environment variables then validate
+func LoadConfig(paths ...string) (*AppConfig, error) {
+	cfg := &AppConfig{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			err = util.FromJson(data, cfg)
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, cfg)
+		default:
+			err = &Error{Type: "UNSUPPORTED_FORMAT", Message: "Config file " + path + " must be .json, .yaml or .yml."}
+		}
+		if err != nil {
+			return nil, &Error{Type: "INVALID_CONFIG", Message: path + ": " + err.Error()}
+		}
+	}
+
+	err := applyEnv(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(ConfigEnvPrefix, "_"))
+	if err != nil {
+		return nil, err
+	}
+
+	// legacy variables
+	if cfg.Env == "" {
+		cfg.Env = os.Getenv("env")
+	}
+	if cfg.Version == "" {
+		cfg.Version = os.Getenv("version")
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// applyEnv override fields of v by environment variables named prefix_FIELD
+func applyEnv(v reflect.Value, prefix string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			if err := applyEnv(v.Field(i), prefix+"_"+envName(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// map values are not addressable, override a copy then put it back
+			item := reflect.New(v.Type().Elem()).Elem()
+			item.Set(v.MapIndex(key))
+			if err := applyEnv(item, prefix+"_"+envName(key.String())); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, item)
+		}
+		return nil
+	}
+
+	raw, ok := os.LookupEnv(prefix)
+	if !ok {
+		return nil
+	}
+	invalid := func(err error) error {
+		return &Error{Type: "INVALID_CONFIG", Message: "Environment variable " + prefix + ": " + err.Error()}
+	}
+
+	if v.Type() == durationType {
+		var d Duration
+		var err error
+		// a bare number is millisecond, as in config files
+		if n, perr := strconv.ParseInt(raw, 10, 64); perr == nil {
+			err = d.set(int(n))
+		} else {
+			err = d.set(raw)
+		}
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		parts := []string{}
+		for _, p := range strings.Split(raw, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		v.Set(reflect.ValueOf(parts))
+	}
+	return nil
+}
+
+func envName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		// camelCase -> CAMEL_CASE
+		if r >= 'A' && r <= 'Z' && i > 0 {
+			prev := name[i-1]
+			if prev >= 'a' && prev <= 'z' {
+				sb.WriteByte('_')
+			}
+		}
+		if r == '-' || r == '.' {
+			r = '_'
+		}
+		sb.WriteRune(r)
+	}
+	return strings.ToUpper(sb.String())
+}
+
+var runtimeConfig = struct {
+	env     string
+	version string
+	loaded  bool
+	lock    sync.RWMutex
+}{}
+
+// Env environment name from loaded config, fallback to $env
+func Env() string {
+	runtimeConfig.lock.RLock()
+	defer runtimeConfig.lock.RUnlock()
+	if runtimeConfig.loaded {
+		return runtimeConfig.env
+	}
+	return os.Getenv("env")
+}
+
+// Version application version from loaded config, fallback to $version
+func Version() string {
+	runtimeConfig.lock.RLock()
+	defer runtimeConfig.lock.RUnlock()
+	if runtimeConfig.loaded {
+		return runtimeConfig.version
+	}
+	return os.Getenv("version")
+}
+
+// LoadConfig load config files & apply log settings, see LoadConfig
+func (app *App) LoadConfig(paths ...string) (*AppConfig, error) {
+	cfg, err := LoadConfig(paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimeConfig.lock.Lock()
+	runtimeConfig.env = cfg.Env
+	runtimeConfig.version = cfg.Version
+	runtimeConfig.loaded = true
+	runtimeConfig.lock.Unlock()
+
+	if cfg.Log.Level != "" || cfg.Log.JSON || cfg.Log.Payload {
+		app.SetLogger(NewLogger(os.Stdout, LoggerConfig{
+			Level:      ParseLogLevel(cfg.Log.Level),
+			JSON:       cfg.Log.JSON,
+			LogPayload: cfg.Log.Payload,
+		}))
+	}
+
+	app.lock.Lock()
+	app.config = cfg
+	app.lock.Unlock()
+	return cfg, nil
+}
+
+// Config return config loaded by LoadConfig, nil if none
+func (app *App) Config() *AppConfig {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	return app.config
+}
+
+// SetupDBClientFromConfig setup DB client declared in section db.<name> of loaded config
+func (app *App) SetupDBClientFromConfig(name string) (*DBClient, error) {
+	cfg := app.Config()
+	if cfg == nil {
+		return nil, &Error{Type: "NOT_LOADED", Message: "Config is not loaded."}
+	}
+	dbCfg, ok := cfg.DB[name]
+	if !ok {
+		return nil, &Error{Type: "NOT_FOUND", Message: "Config has no db." + name + "."}
+	}
+	db := app.SetupDBClient(dbCfg)
+	db.Name = name
+	return db, nil
+}
+
+// SetupWorkerFromConfig setup worker with schedule of section workers.<name>
+func (app *App) SetupWorkerFromConfig(name string) (*Worker, error) {
+	cfg := app.Config()
+	if cfg == nil {
+		return nil, &Error{Type: "NOT_LOADED", Message: "Config is not loaded."}
+	}
+	wkCfg, ok := cfg.Workers[name]
+	if !ok {
+		return nil, &Error{Type: "NOT_FOUND", Message: "Config has no workers." + name + "."}
+	}
+	worker := app.SetupWorker().
+		SetName(name).
+		SetDelay(wkCfg.Delay).
+		SetRepeatPeriod(wkCfg.Period).
+		SetTimeout(time.Duration(wkCfg.Timeout)).
+		SetRetry(wkCfg.MaxRetry, time.Duration(wkCfg.Backoff), time.Duration(wkCfg.MaxBackoff))
+	if wkCfg.Overlap != "" {
+		worker.SetOverlap(OverlapPolicy(strings.ToUpper(wkCfg.Overlap)))
+	}
+	if wkCfg.Cron != "" {
+		worker.SetCron(wkCfg.Cron)
+	}
+	if wkCfg.Timezone != "" {
+		loc, err := time.LoadLocation(wkCfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		worker.SetLocation(loc)
+	}
+	return worker, nil
+}
+
+// NewRestClientFromConfig create client declared in section rest.<name>
+func (app *App) NewRestClientFromConfig(name string) (*RestClient, error) {
+	cfg := app.Config()
+	if cfg == nil {
+		return nil, &Error{Type: "NOT_LOADED", Message: "Config is not loaded."}
+	}
+	rc, ok := cfg.Rest[name]
+	if !ok {
+		return nil, &Error{Type: "NOT_FOUND", Message: "Config has no rest." + name + "."}
+	}
+	client := NewHTTPClient(rc.APIClientConfiguration())
+	client.SetLogger(app.logger.With(F("client", name)))
+	app.Services.AddRestClient(name, client)
+	return client, nil
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvDuration(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Duration
+		ok   bool
+	}{
+		{"3s", 3 * time.Second, true},
+		{"250ms", 250 * time.Millisecond, true},
+		// bare number is millisecond, as in config files
+		{"3000", 3 * time.Second, true},
+		{"0", 0, true},
+		{"3x", 0, false},
+	}
+	for _, tt := range tests {
+		var cfg struct {
+			Timeout Duration `yaml:"timeout"`
+		}
+		t.Setenv("FOOSEE_TEST_TIMEOUT", tt.raw)
+		err := applyEnv(reflect.ValueOf(&cfg).Elem(), "FOOSEE_TEST")
+		if tt.ok != (err == nil) {
+			t.Fatalf("applyEnv(%q) error: %v", tt.raw, err)
+		}
+		if time.Duration(cfg.Timeout) != tt.want {
+			t.Fatalf("applyEnv(%q) = %s, want %s", tt.raw, time.Duration(cfg.Timeout), tt.want)
+		}
+	}
+}
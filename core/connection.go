@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+)
+
+var connCounter uint64
+
+// Connection state of one websocket client
+type Connection struct {
+	ID          string
+	Conn        net.Conn
+	ConnectedAt time.Time
+
+	principal string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	lock      *sync.Mutex
+
+	pending     []*job // requests waiting to be served, in arrival order
+	dispatching bool   // a dispatcher owns pending
+	pendingLock *sync.Mutex
+}
+
+// maxPendingRequests requests of one connection waiting for a dispatcher, more are rejected
+const maxPendingRequests = 256
+
+func newConnection(parent context.Context, conn net.Conn) *Connection {
+	ctx, cancel := context.WithCancel(parent)
+	return &Connection{
+		ID:          strconv.FormatUint(atomic.AddUint64(&connCounter, 1), 10),
+		Conn:        conn,
+		ConnectedAt: time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+		lock:        &sync.Mutex{},
+		pendingLock: &sync.Mutex{},
+	}
+}
+
+// ConnectionInfo ...
+type ConnectionInfo struct {
+	ID          string    `json:"id"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	Principal   string    `json:"principal,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// Info ...
+func (c *Connection) Info() ConnectionInfo {
+	info := ConnectionInfo{
+		ID:          c.ID,
+		Principal:   c.Principal(),
+		ConnectedAt: c.ConnectedAt,
+	}
+	if addr := c.Conn.RemoteAddr(); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	return info
+}
+
+// Principal ...
+func (c *Connection) Principal() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.principal
+}
+
+// SetPrincipal bind an authenticated identity to the connection
+func (c *Connection) SetPrincipal(principal string) *Connection {
+	c.lock.Lock()
+	c.principal = principal
+	c.lock.Unlock()
+	return c
+}
+
+// Context is cancelled when the connection is closed or the server is stopped
+func (c *Connection) Context() context.Context {
+	return c.ctx
+}
+
+// WriteText write a text frame, safe for concurrent handlers
+func (c *Connection) WriteText(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return wsutil.WriteServerText(c.Conn, data)
+}
+
+// enqueue add j to the pending requests, dispatch is true when the connection must be handed to a dispatcher
+func (c *Connection) enqueue(j *job) (dispatch bool, err error) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	if len(c.pending) >= maxPendingRequests {
+		return false, &Error{Type: "TOO_MANY_REQUESTS", Message: "Too many pending requests."}
+	}
+	c.pending = append(c.pending, j)
+	if c.dispatching {
+		return false, nil
+	}
+	c.dispatching = true
+	return true, nil
+}
+
+// next pop the oldest pending request, nil releases the connection from its dispatcher
+func (c *Connection) next() *job {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	if len(c.pending) == 0 {
+		c.dispatching = false
+		return nil
+	}
+	j := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	return j
+}
+
+// close cancel pending handlers and close underlying conn
+func (c *Connection) close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type contextKey int
+
+const (
+	connIDKey contextKey = iota
+	principalKey
+	traceIDKey
+	servicesKey
+)
+
+// ConnIDFromContext return id of the connection which sent the request
+func ConnIDFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(connIDKey).(string)
+	return v
+}
+
+// PrincipalFromContext return principal bound to the connection, empty if anonymous
+func PrincipalFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(principalKey).(string)
+	return v
+}
+
+// TraceIDFromContext return trace id of the request
+func TraceIDFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(traceIDKey).(string)
+	return v
+}
+
+// newRequestContext attach request-scoped values to parent
+func newRequestContext(parent context.Context, conn *Connection, traceID string) context.Context {
+	ctx := context.WithValue(parent, connIDKey, conn.ID)
+	ctx = context.WithValue(ctx, principalKey, conn.Principal())
+	ctx = context.WithValue(ctx, traceIDKey, traceID)
+	return ctx
+}
+
+// newTraceID generate random 16 bytes id in hex
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
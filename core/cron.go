@@ -0,0 +1,302 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule parsed cron expression
+type CronSchedule struct {
+	Expr     string
+	second   uint64
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	domStar  bool
+	dowStar  bool
+	location *time.Location
+	// explicitTZ expression has CRON_TZ prefix
+	explicitTZ bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronSecond = cronField{name: "second", min: 0, max: 59}
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron parse standard cron expression:
+//
+//	minute hour day-of-month month day-of-week          (5 fields)
+//	second minute hour day-of-month month day-of-week   (6 fields)
+//
+// Fields support *, ?, lists (1,15), ranges (1-5), steps (*/5, 10-40/10) and
+// JAN-DEC / SUN-SAT names. Descriptors @yearly, @monthly, @weekly, @daily, @hourly are accepted.
+// Prefix "CRON_TZ=Asia/Ho_Chi_Minh " evaluate the schedule in that timezone, default is local time.
+func ParseCron(expr string) (*CronSchedule, error) {
+	s := &CronSchedule{Expr: expr, location: time.Local}
+
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, cronError(expr, "missing fields after timezone")
+		}
+		tz := spec[strings.Index(spec, "=")+1 : i]
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, cronError(expr, "unknown timezone "+tz)
+		}
+		s.location = loc
+		s.explicitTZ = true
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, cronError(expr, "require 5 or 6 fields, got "+strconv.Itoa(len(fields)))
+	}
+
+	var err error
+	if s.second, err = parseCronField(fields[0], cronSecond); err != nil {
+		return nil, cronError(expr, err.Error())
+	}
+	if s.minute, err = parseCronField(fields[1], cronMinute); err != nil {
+		return nil, cronError(expr, err.Error())
+	}
+	if s.hour, err = parseCronField(fields[2], cronHour); err != nil {
+		return nil, cronError(expr, err.Error())
+	}
+	if s.dom, err = parseCronField(fields[3], cronDom); err != nil {
+		return nil, cronError(expr, err.Error())
+	}
+	if s.month, err = parseCronField(fields[4], cronMonth); err != nil {
+		return nil, cronError(expr, err.Error())
+	}
+	if s.dow, err = parseCronField(fields[5], cronDow); err != nil {
+		return nil, cronError(expr, err.Error())
+	}
+
+	// 7 is also sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = isCronStar(fields[3])
+	s.dowStar = isCronStar(fields[5])
+	return s, nil
+}
+
+// MustParseCron like ParseCron but panic on invalid expression
+func MustParseCron(expr string) *CronSchedule {
+	s, err := ParseCron(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// In return a copy of schedule evaluated in loc
+func (s *CronSchedule) In(loc *time.Location) *CronSchedule {
+	cp := *s
+	cp.location = loc
+	return &cp
+}
+
+// Location ...
+func (s *CronSchedule) Location() *time.Location {
+	return s.location
+}
+
+// Next return the first activation strictly after t, zero time if there is none in the next 5 years.
+// Wall times skipped by a DST change never activate, wall times repeated by it activate twice.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	orig := t.Location()
+	t = t.In(s.location)
+
+	// start from next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = cronDate(t.Year(), t.Month()+1, 1, 0, s.location)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = cronDate(t.Year(), t.Month(), t.Day()+1, 0, s.location)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = cronDate(t.Year(), t.Month(), t.Day(), t.Hour()+1, s.location)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.second&(1<<uint(t.Second())) == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(orig)
+}
+
+// cronDate start of hour in loc, a wall time skipped by a DST change moves to the first instant after it.
+// time.Date moves it backward instead, which would make Next loop forever.
+func cronDate(year int, month time.Month, day int, hour int, loc *time.Location) time.Time {
+	want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return t.Add(want.Sub(got))
+}
+
+// dayMatches standard cron rule: if both day fields are restricted, either one can match
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func isCronStar(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		b, err := parseCronRange(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// parseCronRange parse "*", "?", "5", "1-5", "*/5", "1-30/5", "MON-FRI"
+func parseCronRange(part string, f cronField) (uint64, error) {
+	step := 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		n, err := strconv.Atoi(part[i+1:])
+		if err != nil || n <= 0 {
+			return 0, &Error{Type: "INVALID_CRON", Message: "invalid step in " + f.name + " field: " + part}
+		}
+		step = n
+		part = part[:i]
+	}
+
+	var start, end int
+	switch {
+	case isCronStar(part):
+		start, end = f.min, f.max
+	case strings.Contains(part, "-"):
+		bounds := strings.SplitN(part, "-", 2)
+		var err error
+		if start, err = cronValue(bounds[0], f); err != nil {
+			return 0, err
+		}
+		if end, err = cronValue(bounds[1], f); err != nil {
+			return 0, err
+		}
+		// SUN ends the week in ranges, e.g. MON-SUN or 5-0
+		if f.name == cronDow.name && end == 0 && start > 0 {
+			end = 7
+		}
+	default:
+		v, err := cronValue(part, f)
+		if err != nil {
+			return 0, err
+		}
+		start, end = v, v
+		// "5/10" means from 5 to max every 10
+		if step > 1 {
+			end = f.max
+		}
+	}
+
+	if start > end {
+		return 0, &Error{Type: "INVALID_CRON", Message: "range start is after end in " + f.name + " field: " + part}
+	}
+
+	var bits uint64
+	for v := start; v <= end; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func cronValue(s string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, &Error{Type: "INVALID_CRON", Message: "invalid value in " + f.name + " field: " + s}
+	}
+	if v < f.min || v > f.max {
+		return 0, &Error{Type: "INVALID_CRON", Message: f.name + " value " + s + " out of range " + strconv.Itoa(f.min) + "-" + strconv.Itoa(f.max)}
+	}
+	return v, nil
+}
+
+func cronError(expr string, reason string) error {
+	return &Error{Type: "INVALID_CRON", Message: "cron expression \"" + expr + "\": " + reason}
+}
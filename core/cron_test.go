@@ -0,0 +1,175 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// bits set of values, as parsed cron fields
+func bits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr   string
+		second uint64
+		minute uint64
+		dom    uint64
+		dow    uint64
+	}{
+		{"* * * * *", bits(0), bits(rangeOf(0, 59)...), bits(rangeOf(1, 31)...), bits(rangeOf(0, 7)...)},
+		{"*/15 10-40/10 * * * *", bits(0, 15, 30, 45), bits(10, 20, 30, 40), bits(rangeOf(1, 31)...), bits(rangeOf(0, 7)...)},
+		{"5/20 * 1,15 * ?", bits(0), bits(5, 25, 45), bits(1, 15), bits(rangeOf(0, 7)...)},
+		{"0 9 * * MON-FRI", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(1, 2, 3, 4, 5)},
+		{"0 9 * * mon-sun", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(rangeOf(0, 7)...)},
+		{"0 9 * * 5-0", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(0, 5, 6, 7)},
+		{"0 9 * * SUN-TUE", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(0, 1, 2)},
+		{"0 9 * * 7", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(0, 7)},
+		{"@weekly", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(0)},
+		{"CRON_TZ=UTC @daily", bits(0), bits(0), bits(rangeOf(1, 31)...), bits(rangeOf(0, 7)...)},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error: %v", tt.expr, err)
+		}
+		if s.second != tt.second || s.minute != tt.minute || s.dom != tt.dom || s.dow != tt.dow {
+			t.Fatalf("ParseCron(%q) = second %b, minute %b, dom %b, dow %b", tt.expr, s.second, s.minute, s.dom, s.dow)
+		}
+	}
+}
+
+func rangeOf(from int, to int) []int {
+	var list []int
+	for v := from; v <= to; v++ {
+		list = append(list, v)
+	}
+	return list
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"40-10 * * * *",
+		"* * * * SAT-MON",
+		"* * * * FOO",
+		"CRON_TZ=UTC",
+		"CRON_TZ=Nowhere/City * * * * *",
+	} {
+		_, err := ParseCron(expr)
+		e, ok := err.(*Error)
+		if !ok || e.Type != "INVALID_CRON" {
+			t.Fatalf("ParseCron(%q) error = %v, want INVALID_CRON", expr, err)
+		}
+	}
+}
+
+func TestParseCronTimezone(t *testing.T) {
+	tests := []struct {
+		expr     string
+		location string
+	}{
+		{"0 9 * * *", time.Local.String()},
+		{"CRON_TZ=Asia/Ho_Chi_Minh 0 9 * * *", "Asia/Ho_Chi_Minh"},
+		{"TZ=UTC 0 9 * * *", "UTC"},
+	}
+	for _, tt := range tests {
+		s := MustParseCron(tt.expr)
+		if s.Location().String() != tt.location {
+			t.Fatalf("ParseCron(%q) location = %s, want %s", tt.expr, s.Location(), tt.location)
+		}
+	}
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("no timezone data: " + err.Error())
+	}
+	return loc
+}
+
+func TestCronNext(t *testing.T) {
+	utc := time.UTC
+	ny := loadLocation(t, "America/New_York")
+	havana := loadLocation(t, "America/Havana")
+	hcm := loadLocation(t, "Asia/Ho_Chi_Minh")
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from time.Time
+		want time.Time
+	}{
+		{"weekday", "0 9 * * MON-FRI", utc,
+			time.Date(2021, 3, 13, 10, 0, 0, 0, utc), time.Date(2021, 3, 15, 9, 0, 0, 0, utc)},
+		{"whole week", "0 9 * * MON-SUN", utc,
+			time.Date(2021, 3, 13, 10, 0, 0, 0, utc), time.Date(2021, 3, 14, 9, 0, 0, 0, utc)},
+		{"strictly after", "0 9 * * *", utc,
+			time.Date(2021, 3, 13, 9, 0, 0, 0, utc), time.Date(2021, 3, 14, 9, 0, 0, 0, utc)},
+		{"sub second start", "* * * * * *", utc,
+			time.Date(2021, 3, 13, 9, 0, 0, 500, utc), time.Date(2021, 3, 13, 9, 0, 1, 0, utc)},
+		{"minute step", "*/15 * * * *", utc,
+			time.Date(2021, 3, 13, 10, 7, 30, 0, utc), time.Date(2021, 3, 13, 10, 15, 0, 0, utc)},
+		{"hour wrap", "0 30 1 * * *", utc,
+			time.Date(2021, 12, 31, 23, 0, 0, 0, utc), time.Date(2022, 1, 1, 1, 30, 0, 0, utc)},
+		{"day of month or week", "0 0 13 * FRI", utc,
+			time.Date(2021, 8, 1, 0, 0, 0, 0, utc), time.Date(2021, 8, 6, 0, 0, 0, 0, utc)},
+		{"leap day", "0 0 29 2 *", utc,
+			time.Date(2021, 3, 1, 0, 0, 0, 0, utc), time.Date(2024, 2, 29, 0, 0, 0, 0, utc)},
+		{"never", "0 0 30 2 *", utc,
+			time.Date(2021, 3, 1, 0, 0, 0, 0, utc), time.Time{}},
+
+		{"timezone", "CRON_TZ=Asia/Ho_Chi_Minh 0 9 * * *", nil,
+			time.Date(2021, 3, 13, 0, 0, 0, 0, utc), time.Date(2021, 3, 13, 2, 0, 0, 0, utc)},
+		{"timezone of result is kept", "0 9 * * *", hcm,
+			time.Date(2021, 3, 13, 3, 0, 0, 0, utc), time.Date(2021, 3, 14, 2, 0, 0, 0, utc)},
+
+		// New York: 02:00 EST -> 03:00 EDT on March 14, 02:00 EDT -> 01:00 EST on November 7
+		{"dst skipped time", "0 30 2 * * *", ny,
+			time.Date(2021, 3, 13, 23, 0, 0, 0, ny), time.Date(2021, 3, 15, 2, 30, 0, 0, ny)},
+		{"dst hourly over gap", "0 0 * * * *", ny,
+			time.Date(2021, 3, 14, 1, 0, 0, 0, ny), time.Date(2021, 3, 14, 3, 0, 0, 0, ny)},
+		{"dst after gap", "0 0 12 * * *", ny,
+			time.Date(2021, 3, 13, 13, 0, 0, 0, ny), time.Date(2021, 3, 14, 12, 0, 0, 0, ny)},
+		{"dst repeated time", "0 30 1 * * *", ny,
+			time.Date(2021, 11, 7, 5, 30, 0, 0, utc), time.Date(2021, 11, 7, 6, 30, 0, 0, utc)},
+		{"dst hourly over overlap", "0 0 * * * *", ny,
+			time.Date(2021, 11, 7, 5, 0, 0, 0, utc), time.Date(2021, 11, 7, 6, 0, 0, 0, utc)},
+		// Havana: midnight is skipped, 00:00 CST -> 01:00 CDT on March 14
+		{"dst skipped midnight", "0 0 12 * * *", havana,
+			time.Date(2021, 3, 13, 13, 0, 0, 0, havana), time.Date(2021, 3, 14, 12, 0, 0, 0, havana)},
+		{"dst skipped midnight job", "0 0 0 * * *", havana,
+			time.Date(2021, 3, 13, 1, 0, 0, 0, havana), time.Date(2021, 3, 15, 0, 0, 0, 0, havana)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MustParseCron(tt.expr)
+			if tt.loc != nil {
+				s = s.In(tt.loc)
+			}
+			got := s.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.from.Location() {
+				t.Fatalf("Next(%s) location = %s, want %s", tt.from, got.Location(), tt.from.Location())
+			}
+		})
+	}
+}
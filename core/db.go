@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"reflect"
@@ -38,6 +39,7 @@ type DBModel struct {
 	collection     *mgo.Collection
 	db             *mgo.Database
 	mSession       *DBSession
+	ctx            context.Context
 }
 
 // DBSession ..
@@ -87,13 +89,13 @@ func (e *Error) Error() string {
 
 // DBConfiguration ...
 type DBConfiguration struct {
-	Address            []string
-	Ssl                bool
-	Username           string
-	Password           string
-	AuthDB             string
-	ReplicaSetName     string
-	SecondaryPreferred bool
+	Address            []string `json:"address" yaml:"address"`
+	Ssl                bool     `json:"ssl" yaml:"ssl"`
+	Username           string   `json:"username" yaml:"username"`
+	Password           string   `json:"password" yaml:"password"`
+	AuthDB             string   `json:"authDB" yaml:"authDB"`
+	ReplicaSetName     string   `json:"replicaSetName" yaml:"replicaSetName"`
+	SecondaryPreferred bool     `json:"secondaryPreferred" yaml:"secondaryPreferred"`
 }
 
 // DBClient ..
@@ -101,6 +103,7 @@ type DBClient struct {
 	Name        string
 	Config      DBConfiguration
 	onConnected OnConnectedHandler
+	session     *DBSession
 }
 
 // OnConnectedHandler ...
@@ -136,18 +139,35 @@ func (client *DBClient) Connect() error {
 		}
 	}
 	session, err := mgo.DialWithInfo(&dialInfo)
+	if err != nil {
+		return err
+	}
+
 	if client.Config.SecondaryPreferred {
 		session.SetMode(mgo.SecondaryPreferred, true)
 	}
 
-	if err != nil {
-		return err
+	client.session = &DBSession{session: session, database: client.Config.AuthDB}
+	if client.onConnected == nil {
+		return nil
 	}
-
-	err = client.onConnected(&DBSession{session: session, database: client.Config.AuthDB})
+	err = client.onConnected(client.session)
 	return err
 }
 
+// Session return connected session, nil if not connected
+func (client *DBClient) Session() *DBSession {
+	return client.session
+}
+
+// Close close session opened by Connect
+func (client *DBClient) Close() {
+	if client.session != nil {
+		client.session.Close()
+		client.session = nil
+	}
+}
+
 // convertToObject convert bson to object
 func (m *DBModel) convertToObject(b bson.M) (interface{}, error) {
 	obj := m.NewObject()
@@ -211,6 +231,36 @@ func (m *DBModel) NewList(limit int) interface{} {
 	return reflect.MakeSlice(reflect.SliceOf(t), 0, limit).Interface()
 }
 
+// WithContext return a copy of model which trace operations as child spans of ctx
+func (m *DBModel) WithContext(ctx context.Context) *DBModel {
+	cp := *m
+	cp.ctx = ctx
+	return &cp
+}
+
+func (m *DBModel) startSpan(op string) *Span {
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := GetTracer().Start(ctx, m.ColName+"."+op, SpanKindClient)
+	span.SetAttribute("db.system", "mongodb")
+	span.SetAttribute("db.name", m.DBName)
+	span.SetAttribute("db.collection", m.ColName)
+	span.SetAttribute("db.operation", op)
+	return span
+}
+
+func (m *DBModel) endSpan(span *Span, resp *DbResponse) {
+	if resp != nil {
+		span.SetAttribute("db.status", resp.Status)
+		if resp.Status == DbStatus.Error {
+			span.SetStatus(SpanStatusError, resp.Message)
+		}
+	}
+	span.End()
+}
+
 // GetFreshSession ...
 func (m *DBModel) GetFreshSession() *DBSession {
 	return m.mSession.Copy()
@@ -225,7 +275,10 @@ func (m *DBModel) GetColWith(s *DBSession) (*mgo.Collection, error) {
 }
 
 // Create insert one object into DB
-func (m *DBModel) Create(entity interface{}) *DbResponse {
+func (m *DBModel) Create(entity interface{}) (resp *DbResponse) {
+	span := m.startSpan("Create")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -279,7 +332,10 @@ func (m *DBModel) Create(entity interface{}) *DbResponse {
 }
 
 // CreateMany insert many object into db
-func (m *DBModel) CreateMany(entityList ...interface{}) *DbResponse {
+func (m *DBModel) CreateMany(entityList ...interface{}) (resp *DbResponse) {
+	span := m.startSpan("CreateMany")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -345,7 +401,10 @@ func (m *DBModel) CreateMany(entityList ...interface{}) *DbResponse {
 }
 
 // Query Get all object in DB
-func (m *DBModel) Query(query interface{}, offset int, limit int, reverse bool) *DbResponse {
+func (m *DBModel) Query(query interface{}, offset int, limit int, reverse bool) (resp *DbResponse) {
+	span := m.startSpan("Query")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -390,7 +449,10 @@ func (m *DBModel) Query(query interface{}, offset int, limit int, reverse bool)
 }
 
 // QueryS Get all object in DB with orderby clause
-func (m *DBModel) QueryS(query interface{}, offset int, limit int, sortStr string) *DbResponse {
+func (m *DBModel) QueryS(query interface{}, offset int, limit int, sortStr string) (resp *DbResponse) {
+	span := m.startSpan("QueryS")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -435,7 +497,10 @@ func (m *DBModel) QueryS(query interface{}, offset int, limit int, sortStr strin
 }
 
 // Update Update all matched item
-func (m *DBModel) Update(query interface{}, updater interface{}) *DbResponse {
+func (m *DBModel) Update(query interface{}, updater interface{}) (resp *DbResponse) {
+	span := m.startSpan("Update")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -483,7 +548,10 @@ func (m *DBModel) Update(query interface{}, updater interface{}) *DbResponse {
 }
 
 // QueryOne ...
-func (m *DBModel) QueryOne(query interface{}) *DbResponse {
+func (m *DBModel) QueryOne(query interface{}) (resp *DbResponse) {
+	span := m.startSpan("QueryOne")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -516,7 +584,10 @@ func (m *DBModel) QueryOne(query interface{}) *DbResponse {
 }
 
 // UpdateOne Update one matched object.
-func (m *DBModel) UpdateOne(query interface{}, updater interface{}) *DbResponse {
+func (m *DBModel) UpdateOne(query interface{}, updater interface{}) (resp *DbResponse) {
+	span := m.startSpan("UpdateOne")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -574,7 +645,10 @@ func (m *DBModel) UpdateOne(query interface{}, updater interface{}) *DbResponse
 }
 
 // UpsertOne Update one matched object, if notfound, create new document
-func (m *DBModel) UpsertOne(query interface{}, updater interface{}) *DbResponse {
+func (m *DBModel) UpsertOne(query interface{}, updater interface{}) (resp *DbResponse) {
+	span := m.startSpan("UpsertOne")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -635,7 +709,10 @@ func (m *DBModel) UpsertOne(query interface{}, updater interface{}) *DbResponse
 }
 
 // Delete Delete all object which matched with selector
-func (m *DBModel) Delete(selector interface{}) *DbResponse {
+func (m *DBModel) Delete(selector interface{}) (resp *DbResponse) {
+	span := m.startSpan("Delete")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -663,7 +740,10 @@ func (m *DBModel) Delete(selector interface{}) *DbResponse {
 }
 
 // Count Count object which matched with query.
-func (m *DBModel) Count(query interface{}) *DbResponse {
+func (m *DBModel) Count(query interface{}) (resp *DbResponse) {
+	span := m.startSpan("Count")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -694,7 +774,10 @@ func (m *DBModel) Count(query interface{}) *DbResponse {
 }
 
 // IncreOne Increase one field of the document & return new value
-func (m *DBModel) IncreOne(query interface{}, fieldName string, value int) *DbResponse {
+func (m *DBModel) IncreOne(query interface{}, fieldName string, value int) (resp *DbResponse) {
+	span := m.startSpan("IncreOne")
+	defer func() { m.endSpan(span, resp) }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -740,7 +823,10 @@ func (m *DBModel) IncreOne(query interface{}, fieldName string, value int) *DbRe
 }
 
 // CreateIndex ...
-func (m *DBModel) CreateIndex(index mgo.Index) error {
+func (m *DBModel) CreateIndex(index mgo.Index) (err error) {
+	span := m.startSpan("CreateIndex")
+	defer func() { span.RecordError(err).End() }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
@@ -752,7 +838,10 @@ func (m *DBModel) CreateIndex(index mgo.Index) error {
 }
 
 // Aggregate ...
-func (m *DBModel) Aggregate(pipeline interface{}, result interface{}) error {
+func (m *DBModel) Aggregate(pipeline interface{}, result interface{}) (err error) {
+	span := m.startSpan("Aggregate")
+	defer func() { span.RecordError(err).End() }()
+
 	s := m.GetFreshSession()
 	defer s.Close()
 	col, err := m.GetColWith(s)
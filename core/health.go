@@ -0,0 +1,229 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/binhgo/foosee/util"
+)
+
+// HealthCheckFn return nil if healthy
+type HealthCheckFn = func(ctx context.Context) error
+
+// Health status
+const (
+	HealthUp   = "UP"
+	HealthDown = "DOWN"
+)
+
+// healthCheckTimeout maximum duration of one check
+const healthCheckTimeout = 5 * time.Second
+
+type healthCheck struct {
+	name     string
+	check    HealthCheckFn
+	liveness bool
+}
+
+// HealthCheckResult ...
+type HealthCheckResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// HealthReport ...
+type HealthReport struct {
+	Status string              `json:"status"`
+	State  AppState            `json:"state"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// AddHealthCheck add readiness check, reported by /readyz
+func (app *App) AddHealthCheck(name string, check HealthCheckFn) {
+	app.lock.Lock()
+	app.healthChecks = append(app.healthChecks, &healthCheck{name: name, check: check})
+	app.lock.Unlock()
+}
+
+// AddLivenessCheck add liveness check, reported by both /healthz and /readyz.
+// Failing liveness makes Kubernetes restart the pod, keep these checks local to the process.
+func (app *App) AddLivenessCheck(name string, check HealthCheckFn) {
+	app.lock.Lock()
+	app.healthChecks = append(app.healthChecks, &healthCheck{name: name, check: check, liveness: true})
+	app.lock.Unlock()
+}
+
+// AddQueue register queue so its consumers are reported by /readyz,
+// it is also available to handlers as ServicesFromContext(ctx).Queue(queue.ColName).
+// The queue logs to app logger unless it has its own.
+func (app *App) AddQueue(queue *DBQueue2) {
+	if queue.logger == nil {
+		queue.SetLogger(app.logger)
+	}
+	app.lock.Lock()
+	app.QueueList = append(app.QueueList, queue)
+	app.lock.Unlock()
+	app.Services.AddQueue(queue.ColName, queue)
+}
+
+// builtinChecks checks of DB clients, server & queues known by app
+func (app *App) builtinChecks() []*healthCheck {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	checks := []*healthCheck{}
+	for i, db := range app.DBList {
+		name := db.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		client := db
+		checks = append(checks, &healthCheck{name: "db:" + name, check: func(ctx context.Context) error {
+			s := client.Session()
+			if s == nil {
+				return &Error{Type: "NOT_CONNECTED", Message: "DB is not connected."}
+			}
+			if !s.Valid() {
+				return &Error{Type: "PING_FAILED", Message: "DB does not respond to ping."}
+			}
+			return nil
+		}})
+	}
+	if app.Server != nil && app.Server.Poll != nil {
+		checks = append(checks, &healthCheck{name: "server", check: app.Server.HealthCheck, liveness: true})
+	}
+	for _, q := range app.QueueList {
+		checks = append(checks, &healthCheck{name: "queue:" + q.ColName, check: q.HealthCheck})
+	}
+	return append(checks, app.healthChecks...)
+}
+
+// Health run checks concurrently, liveness = true only run liveness checks
+func (app *App) Health(ctx context.Context, liveness bool) *HealthReport {
+	all := app.builtinChecks()
+	checks := make([]*healthCheck, 0, len(all))
+	for _, c := range all {
+		if !liveness || c.liveness {
+			checks = append(checks, c)
+		}
+	}
+
+	results := make([]HealthCheckResult, len(checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := &HealthReport{Status: HealthUp, State: app.State(), Checks: results}
+
+	// not running app is not ready, but still alive while starting
+	if !liveness && report.State != AppStateRunning {
+		report.Status = HealthDown
+	}
+	if report.State == AppStateFailed || report.State == AppStateStopped {
+		report.Status = HealthDown
+	}
+	for _, r := range results {
+		if r.Status != HealthUp {
+			report.Status = HealthDown
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, c *healthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	rs := HealthCheckResult{
+		Name:       c.name,
+		Status:     HealthUp,
+		DurationMS: time.Since(start).Nanoseconds() / 1e6,
+	}
+	if err != nil {
+		rs.Status = HealthDown
+		rs.Error = err.Error()
+	}
+	return rs
+}
+
+// HealthHandler serve /healthz (liveness) & /readyz (readiness)
+func (app *App) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, app.Health(r.Context(), true))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, app.Health(r.Context(), false))
+	})
+	return mux
+}
+
+func writeHealthReport(w http.ResponseWriter, report *HealthReport) {
+	body, _ := util.ToJson(report)
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != HealthUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(body)
+}
+
+// SetupHealthServer serve health endpoints on addr while app is running,
+// empty addr means server.healthListen of loaded config
+func (app *App) SetupHealthServer(addr string) {
+	if cfg := app.Config(); addr == "" && cfg != nil {
+		addr = cfg.Server.HealthListen
+	}
+	app.Register("health", &httpComponent{
+		server: &http.Server{Addr: addr, Handler: app.HealthHandler()},
+		logger: app.logger,
+	})
+}
+
+// httpComponent run an http.Server as a Component
+type httpComponent struct {
+	server *http.Server
+	logger Logger
+}
+
+func (c *httpComponent) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", c.server.Addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := c.server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			c.logger.Error("HTTP server error", F("addr", c.server.Addr), F("error", err))
+		}
+	}()
+	return nil
+}
+
+func (c *httpComponent) Stop(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func failingCheck(ctx context.Context) error {
+	return &Error{Type: "DOWN", Message: "Check failed."}
+}
+
+func passingCheck(ctx context.Context) error {
+	return nil
+}
+
+func healthGet(t *testing.T, app *App, path string) (int, HealthReport) {
+	w := httptest.NewRecorder()
+	app.HealthHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("GET %s content type = %q, want application/json", path, ct)
+	}
+	var report HealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("GET %s body %s: %v", path, w.Body.String(), err)
+	}
+	return w.Code, report
+}
+
+func TestHealthReadiness(t *testing.T) {
+	app := NewApp("test")
+	app.AddHealthCheck("ready", passingCheck)
+	app.AddLivenessCheck("alive", passingCheck)
+
+	// not running yet: alive, not ready
+	if code, report := healthGet(t, app, "/readyz"); code != http.StatusServiceUnavailable || report.Status != HealthDown || report.State != AppStateNew {
+		t.Fatalf("/readyz of a new app = %d %+v, want 503 DOWN", code, report)
+	}
+	if code, report := healthGet(t, app, "/healthz"); code != http.StatusOK || report.Status != HealthUp {
+		t.Fatalf("/healthz of a new app = %d %+v, want 200 UP", code, report)
+	}
+
+	app.setState(AppStateRunning)
+	code, report := healthGet(t, app, "/readyz")
+	if code != http.StatusOK || report.Status != HealthUp || len(report.Checks) != 2 {
+		t.Fatalf("/readyz of a running app = %d %+v, want 200 UP of 2 checks", code, report)
+	}
+	// liveness only runs liveness checks
+	if _, report := healthGet(t, app, "/healthz"); len(report.Checks) != 1 || report.Checks[0].Name != "alive" {
+		t.Fatalf("/healthz checks = %+v, want only alive", report.Checks)
+	}
+
+	app.setState(AppStateStopped)
+	if code, _ := healthGet(t, app, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("/healthz of a stopped app = %d, want 503", code)
+	}
+}
+
+func TestHealthFailingCheck(t *testing.T) {
+	app := NewApp("test")
+	app.AddHealthCheck("ready", failingCheck)
+	app.AddLivenessCheck("alive", passingCheck)
+	app.AddQueue(testConsumer(1, false, time.Now().Add(-2*connectorStuckAfter)))
+	app.setState(AppStateRunning)
+
+	code, report := healthGet(t, app, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != HealthDown || report.State != AppStateRunning {
+		t.Fatalf("/readyz with a failing check = %d %+v, want 503 DOWN", code, report)
+	}
+	status := map[string]HealthCheckResult{}
+	for _, c := range report.Checks {
+		status[c.Name] = c
+	}
+	if c := status["ready"]; c.Status != HealthDown || c.Error != failingCheck(nil).Error() {
+		t.Fatalf("failing check = %+v, want DOWN with its error", c)
+	}
+	if c := status["queue:test"]; c.Status != HealthDown {
+		t.Fatalf("stuck queue check = %+v, want DOWN", c)
+	}
+	if c := status["alive"]; c.Status != HealthUp || c.Error != "" {
+		t.Fatalf("passing check = %+v, want UP without error", c)
+	}
+
+	// a failing readiness check does not fail liveness
+	if code, _ := healthGet(t, app, "/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz with a failing readiness check = %d, want 200", code)
+	}
+}
+
+func TestHealthJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeHealthReport(w, &HealthReport{
+		Status: HealthDown,
+		State:  AppStateRunning,
+		Checks: []HealthCheckResult{
+			{Name: "a", Status: HealthUp, DurationMS: 1},
+			{Name: "b", Status: HealthDown, Error: "boom", DurationMS: 2},
+		},
+	})
+	want := `{"status":"DOWN","state":"RUNNING","checks":[` +
+		`{"name":"a","status":"UP","durationMs":1},` +
+		`{"name":"b","status":"DOWN","error":"boom","durationMs":2}]}`
+	if w.Body.String() != want {
+		t.Fatalf("body = %s, want %s", w.Body.String(), want)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status code = %d, want 503", w.Code)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r := runHealthCheck(ctx, &healthCheck{name: "slow", check: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+	if r.Status != HealthDown || r.Error == "" {
+		t.Fatalf("check outliving ctx = %+v, want DOWN", r)
+	}
+}
@@ -3,10 +3,10 @@ package core
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -73,7 +73,8 @@ type RestClient struct {
 	waitTime     time.Duration // milisecond
 	timeOut      time.Duration // milisecond
 
-	debug bool
+	debug  bool
+	logger Logger
 }
 
 // RequestLogEntry ...
@@ -166,6 +167,7 @@ func NewRESTClient(baseURL string, logName string, timeout time.Duration, maxRet
 	restCl.SetWaitTime(waitTime)
 	restCl.SetTimeout(timeout)
 	restCl.debug = false
+	restCl.logger = DefaultLogger
 	if logName != "" {
 		restCl.SetLoggerName(logName)
 	}
@@ -224,10 +226,22 @@ func (c *RestClient) SetDBLog(dbName string, session *DBSession) {
 	c.logModel = &model
 }
 
+// SetDebug trace each step of requests, written at debug level of logger
 func (c *RestClient) SetDebug(val bool) {
 	c.debug = val
 }
 
+// SetLogger ...
+func (c *RestClient) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+func (c *RestClient) logDebug(msg string, fields ...Field) {
+	if c.debug {
+		c.logger.Debug(msg, fields...)
+	}
+}
+
 // SetTimeout :
 func (c *RestClient) SetTimeout(timeout time.Duration) {
 	c.timeOut = timeout
@@ -288,7 +302,7 @@ func (c *RestClient) initRequest(method HTTPMethod, headers map[string]string, p
 	userAgent := "Go-RESTClient/1.0"
 	hostname, err := os.Hostname()
 	if err == nil {
-		userAgent += " " + hostname + "/" + os.Getenv("env")
+		userAgent += " " + hostname + "/" + Env()
 	}
 
 	req.Header.Set("User-Agent", userAgent)
@@ -308,15 +322,24 @@ func (c *RestClient) MakeHTTPRequest(method HTTPMethod, headers map[string]strin
 
 func (c *RestClient) writeLog(logEntry *RequestLogEntry) {
 
-	if c.debug {
-		fmt.Println(" +++ Writing log ...")
-	}
+	c.logDebug("Writing request log")
 	go c.logModel.Create(logEntry)
 
 }
 
 // MakeHTTPRequestWithKey
 func (c *RestClient) MakeHTTPRequestWithKey(method HTTPMethod, headers map[string]string, params map[string]string, body interface{}, path string, keys *[]string) (*RestResult, error) {
+	return c.MakeHTTPRequestWithContext(context.Background(), method, headers, params, body, path, keys)
+}
+
+// MakeHTTPRequestWithContext make request as child span of ctx & propagate traceparent header,
+// request is aborted when ctx is done
+func (c *RestClient) MakeHTTPRequestWithContext(ctx context.Context, method HTTPMethod, headers map[string]string, params map[string]string, body interface{}, path string, keys *[]string) (*RestResult, error) {
+
+	ctx, span := GetTracer().Start(ctx, string(method)+" "+path, SpanKindClient)
+	span.SetAttribute("http.method", string(method))
+	span.SetAttribute("http.url", c.BaseURL.String()+path)
+	defer span.End()
 
 	date := time.Now()
 	// init log
@@ -334,53 +357,51 @@ func (c *RestClient) MakeHTTPRequestWithKey(method HTTPMethod, headers map[strin
 		defer c.writeLog(logEntry)
 	}
 
-	if c.debug {
-		fmt.Println(" +++ Try to init request ...")
-	}
+	c.logDebug("Try to init request")
 
 	canRetryCount := c.maxRetryTime
 
 	tstart := time.Now().UnixNano() / 1e6
 
+RETRY:
 	for canRetryCount >= 0 {
 
 		req, reqErr := c.initRequest(method, headers, params, body, path)
-
-		if c.debug {
-			fmt.Println(" +++ Init request successfully.")
+		if reqErr == nil {
+			req = req.WithContext(ctx)
+			req.Header.Set("traceparent", span.Traceparent())
 		}
 
+		c.logDebug("Init request successfully")
+
 		if reqErr != nil {
 			msg := reqErr.Error()
 			logEntry.ErrorLog = &msg
+			span.RecordError(reqErr)
 			return nil, reqErr
 		}
 		// start time
 		startCallTime := time.Now().UnixNano() / 1e6
-		if c.debug {
-			fmt.Println("+++ Let call: " + logEntry.ReqMethod + " " + logEntry.ReqURL)
-		}
+		c.logDebug("Calling endpoint", F("method", logEntry.ReqMethod), F("url", logEntry.ReqURL))
 
 		// add call result
 		callRs := &CallResult{}
 
 		// do request
 		resp, err := c.httpClient.Do(req)
-		if c.debug {
-			fmt.Println("+++ HTTP call ended!")
-		}
+		c.logDebug("HTTP call ended")
 
 		// make request successful
 		if err == nil {
 			restResult, err := c.readBody(resp, callRs, logEntry, canRetryCount, startCallTime, tstart)
 			if restResult != nil {
 				logEntry.Status = "SUCCESS"
+				span.SetAttribute("http.status_code", restResult.Code)
+				span.SetAttribute("http.retry_count", logEntry.RetryCount)
 				return restResult, err
 			}
 		} else {
-			if c.debug {
-				fmt.Println("HTTP Error: " + err.Error())
-			}
+			c.logDebug("HTTP error", F("url", logEntry.ReqURL), F("error", err))
 			msg := err.Error()
 			callRs.ErrorLog = &msg
 		}
@@ -390,33 +411,38 @@ func (c *RestClient) MakeHTTPRequestWithKey(method HTTPMethod, headers map[strin
 
 		canRetryCount--
 
+		// caller gave up, no need to retry
+		if ctx.Err() != nil {
+			logEntry.addResult(callRs)
+			break
+		}
+
 		if canRetryCount >= 0 {
-			time.Sleep(c.waitTime)
-			if c.debug {
-				fmt.Println("Comeback from sleep ...")
+			select {
+			case <-time.After(c.waitTime):
+				c.logDebug("Comeback from sleep")
+			case <-ctx.Done():
+				// caller gave up while waiting
+				logEntry.addResult(callRs)
+				break RETRY
 			}
 		}
 
-		if c.debug {
-			fmt.Println("Count down ...")
-		}
+		c.logDebug("Count down", F("remaining", canRetryCount))
 		if canRetryCount >= 0 {
 			logEntry.RetryCount = c.maxRetryTime - canRetryCount
 		}
 		logEntry.addResult(callRs)
-		if c.debug {
-			fmt.Println("Try to exit loop ...")
-		}
 	}
 
-	if c.debug {
-		fmt.Println("Exit retry loop.")
-	}
+	c.logDebug("Exit retry loop", F("url", logEntry.ReqURL))
 
 	tend := time.Now().UnixNano() / 1e6
 	logEntry.TotalTime = tend - tstart
 	logEntry.Status = "FAILED"
-	return nil, errors.New("fail to call endpoint API " + logEntry.ReqURL)
+	err := errors.New("fail to call endpoint API " + logEntry.ReqURL)
+	span.RecordError(err)
+	return nil, err
 }
 
 func (c *RestClient) readBody(resp *http.Response, callRs *CallResult, logEntry *RequestLogEntry, canRetryCount int, startCallTime int64, tstart int64) (*RestResult, error) {
@@ -428,9 +454,7 @@ func (c *RestClient) readBody(resp *http.Response, callRs *CallResult, logEntry
 		return nil, err
 	}
 
-	if c.debug {
-		fmt.Println("+++ IO read ended!")
-	}
+	c.logDebug("IO read ended")
 	restResult := RestResult{
 		Code:    resp.StatusCode,
 		Body:    string(v),
@@ -439,18 +463,14 @@ func (c *RestClient) readBody(resp *http.Response, callRs *CallResult, logEntry
 
 	encoding := resp.Header.Get("Content-Encoding")
 	if encoding == "gzip" {
-		if c.debug {
-			fmt.Println("+++ Start to gunzip")
-		}
+		c.logDebug("Start to gunzip")
 		gr, _ := gzip.NewReader(bytes.NewBuffer(restResult.Content))
 		data, err := ioutil.ReadAll(gr)
 		gr.Close()
 		if err != nil {
 			return nil, err
 		}
-		if c.debug {
-			fmt.Println("+++ gunzip successfully")
-		}
+		c.logDebug("Gunzip successfully")
 		restResult.Content = data
 		restResult.Body = string(data)
 	}
@@ -470,9 +490,7 @@ func (c *RestClient) readBody(resp *http.Response, callRs *CallResult, logEntry
 		}
 	}
 
-	if c.debug {
-		fmt.Println("+++ Read data end, http code: " + string(resp.StatusCode))
-	}
+	c.logDebug("Read data end", F("code", resp.StatusCode))
 	if (resp.StatusCode >= 200 && resp.StatusCode < 300) || (resp.StatusCode >= 400 && resp.StatusCode < 500) {
 		// add log
 		tend := time.Now().UnixNano() / 1e6
@@ -510,12 +528,7 @@ func (c *RestClient) MakeRequest(req OutboundAPIRequest) *APIResponse {
 		method = HTTPMethods.Option
 	}
 
-	if c.debug {
-		fmt.Println("Req info: " + reqMethod.Value + " / " + req.GetPath())
-		if data != nil {
-			fmt.Println("Data not null")
-		}
-	}
+	c.logDebug("Req info", F("method", reqMethod.Value), F("path", req.GetPath()), F("hasData", data != nil))
 
 	result, err := c.MakeHTTPRequest(method, req.GetHeaders(), req.GetParams(), data, req.GetPath())
 
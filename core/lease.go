@@ -0,0 +1,150 @@
+package core
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Lease document, one per lease name
+type Lease struct {
+	Name            string     `json:"name" bson:"_id"`
+	Owner           string     `json:"owner" bson:"owner"`
+	Host            string     `json:"host" bson:"host"`
+	ExpireAt        time.Time  `json:"expireAt" bson:"expire_at"`
+	CreatedTime     *time.Time `json:"createdTime,omitempty" bson:"created_time,omitempty"`
+	LastUpdatedTime *time.Time `json:"lastUpdatedTime,omitempty" bson:"last_updated_time,omitempty"`
+}
+
+// DBLease named leases stored in collection ColName, used to elect one owner among replicas.
+// Expiry is compared with local clock of each replica, keep ttl much larger than the clock skew.
+type DBLease struct {
+	ColName  string
+	leaseDB  *DBModel
+	hostname string
+	owner    string
+	ready    bool
+}
+
+// Init ...
+func (l *DBLease) Init(mSession *DBSession, dbName string) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "undefined"
+	}
+	l.hostname = hostname
+	l.owner = hostname + "/" + strconv.Itoa(os.Getpid())
+
+	l.leaseDB = &DBModel{
+		ColName:        l.ColName,
+		DBName:         dbName,
+		TemplateObject: &Lease{},
+	}
+	err = l.leaseDB.Init(mSession)
+	if err != nil {
+		return err
+	}
+
+	// leases abandoned for a long time are removed by mongo
+	l.leaseDB.CreateIndex(mgo.Index{
+		Key:         []string{"expire_at"},
+		Background:  true,
+		ExpireAfter: time.Hour,
+	})
+	l.ready = true
+	return nil
+}
+
+// Owner identity of this process in lease documents, "hostname/pid"
+func (l *DBLease) Owner() string {
+	return l.owner
+}
+
+// Acquire take lease name for ttl if it is free, expired or already owned by this process,
+// return false if another owner holds it
+func (l *DBLease) Acquire(name string, ttl time.Duration) (held bool, err error) {
+	if !l.ready {
+		return false, &Error{Type: "NOT_INITED", Message: "Require to init database before using lease."}
+	}
+	span := l.leaseDB.startSpan("AcquireLease")
+	defer func() { span.RecordError(err).End() }()
+
+	s := l.leaseDB.GetFreshSession()
+	defer s.Close()
+	col, err := l.leaseDB.GetColWith(s)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	change := mgo.Change{
+		Update: bson.M{
+			"$set": bson.M{
+				"owner":             l.owner,
+				"host":              l.hostname,
+				"expire_at":         now.Add(ttl),
+				"last_updated_time": now,
+			},
+			"$setOnInsert": bson.M{
+				"created_time": now,
+			},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	// when the lease is held by other, the query does not match & upsert hits duplicated _id
+	_, err = col.Find(bson.M{
+		"_id": name,
+		"$or": []bson.M{
+			{"owner": l.owner},
+			{"expire_at": bson.M{"$lt": now}},
+		},
+	}).Apply(change, &Lease{})
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release give up lease name if owned by this process
+func (l *DBLease) Release(name string) (err error) {
+	if !l.ready {
+		return &Error{Type: "NOT_INITED", Message: "Require to init database before using lease."}
+	}
+	span := l.leaseDB.startSpan("ReleaseLease")
+	defer func() { span.RecordError(err).End() }()
+
+	s := l.leaseDB.GetFreshSession()
+	defer s.Close()
+	col, err := l.leaseDB.GetColWith(s)
+	if err != nil {
+		return err
+	}
+	err = col.Remove(bson.M{"_id": name, "owner": l.owner})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Get current holder of lease name, nil if nobody holds it
+func (l *DBLease) Get(name string) (*Lease, error) {
+	if !l.ready {
+		return nil, &Error{Type: "NOT_INITED", Message: "Require to init database before using lease."}
+	}
+	resp := l.leaseDB.QueryOne(bson.M{"_id": name, "expire_at": bson.M{"$gte": time.Now()}})
+	switch resp.Status {
+	case DbStatus.Ok:
+		return resp.Data.([]*Lease)[0], nil
+	case DbStatus.NotFound:
+		return nil, nil
+	}
+	return nil, &Error{Type: resp.ErrorCode, Message: resp.Message}
+}
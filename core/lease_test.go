@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLeases two DBLease of distinct owners on a fresh collection,
+// skipped unless FOOSEE_TEST_MONGO holds comma separated addresses of a MongoDB
+func testLeases(t *testing.T) (a *DBLease, b *DBLease) {
+	addr := os.Getenv("FOOSEE_TEST_MONGO")
+	if addr == "" {
+		t.Skip("FOOSEE_TEST_MONGO is not set")
+	}
+	client := &DBClient{Name: "test", Config: DBConfiguration{Address: strings.Split(addr, ",")}}
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	col := "lease_test_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	a, b = &DBLease{ColName: col}, &DBLease{ColName: col}
+	for _, l := range []*DBLease{a, b} {
+		if err := l.Init(client.Session(), "foosee_test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// same process, tell owners apart
+	a.owner += "/a"
+	b.owner += "/b"
+	t.Cleanup(func() { a.leaseDB.collection.DropCollection() })
+	return a, b
+}
+
+func TestLeaseAcquire(t *testing.T) {
+	a, b := testLeases(t)
+
+	if held, err := a.Acquire("job", time.Hour); err != nil || !held {
+		t.Fatalf("Acquire() of a free lease = %v, %v, want held", held, err)
+	}
+	// renew by the owner
+	if held, err := a.Acquire("job", time.Hour); err != nil || !held {
+		t.Fatalf("Acquire() by the owner = %v, %v, want held", held, err)
+	}
+	// the query misses the lease of a, the upsert hits its _id: not held, not an error
+	if held, err := b.Acquire("job", time.Hour); err != nil || held {
+		t.Fatalf("Acquire() of a held lease = %v, %v, want not held without error", held, err)
+	}
+	lease, err := b.Get("job")
+	if err != nil || lease == nil || lease.Owner != a.Owner() {
+		t.Fatalf("Get() = %+v, %v, want lease of %s", lease, err, a.Owner())
+	}
+
+	// release by another owner is ignored
+	if err := b.Release("job"); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := b.Acquire("job", time.Hour); held {
+		t.Fatal("lease released by another owner")
+	}
+	if err := a.Release("job"); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := b.Acquire("job", time.Hour); err != nil || !held {
+		t.Fatalf("Acquire() of a released lease = %v, %v, want held", held, err)
+	}
+}
+
+func TestLeaseTakeoverAfterExpiry(t *testing.T) {
+	a, b := testLeases(t)
+
+	if held, err := a.Acquire("job", 100*time.Millisecond); err != nil || !held {
+		t.Fatalf("Acquire() = %v, %v, want held", held, err)
+	}
+	if held, _ := b.Acquire("job", time.Hour); held {
+		t.Fatal("lease taken over before expiry")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if lease, err := a.Get("job"); err != nil || lease != nil {
+		t.Fatalf("Get() of an expired lease = %+v, %v, want nil", lease, err)
+	}
+	if held, err := b.Acquire("job", time.Hour); err != nil || !held {
+		t.Fatalf("Acquire() of an expired lease = %v, %v, want held", held, err)
+	}
+	// the former owner lost it
+	if held, err := a.Acquire("job", time.Hour); err != nil || held {
+		t.Fatalf("Acquire() by the former owner = %v, %v, want not held", held, err)
+	}
+}
+
+func TestSingletonLeaseTTL(t *testing.T) {
+	tests := []struct {
+		ttl time.Duration
+		ok  bool
+	}{
+		{0, false},
+		{2 * time.Nanosecond, false},
+		{time.Millisecond, false},
+		{time.Second, true},
+	}
+	for _, tt := range tests {
+		worker := (&Worker{Name: "job"}).SetTask(func() {}).SetSingleton(&DBLease{}, tt.ttl)
+		err := worker.Start(context.Background())
+		if tt.ok != (err == nil) {
+			t.Fatalf("Start() with lease ttl %s: error %v", tt.ttl, err)
+		}
+		if err != nil {
+			if e, ok := err.(*Error); !ok || e.Type != "INVALID_SINGLETON" {
+				t.Fatalf("Start() with lease ttl %s: error %v, want INVALID_SINGLETON", tt.ttl, err)
+			}
+		}
+		worker.Stop(context.Background())
+	}
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel ...
+type LogLevel int
+
+// Log levels, from the most verbose
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLogLevel parse debug/info/warn/error, default info
+func ParseLogLevel(s string) LogLevel {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	}
+	return LevelInfo
+}
+
+// Field structured key/value attached to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F short-hand to create a Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// payload is rendered only if the logger allow logging payload
+type payload []byte
+
+// Payload field holding a message body, redacted by default
+func Payload(key string, data []byte) Field {
+	return Field{Key: key, Value: payload(data)}
+}
+
+// Logger ...
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+
+	// With return a child logger which always attach fields
+	With(fields ...Field) Logger
+}
+
+// LoggerConfig ...
+type LoggerConfig struct {
+	Level LogLevel
+	// JSON write one json object per line instead of text
+	JSON bool
+	// LogPayload write content of Payload fields, otherwise only their size
+	LogPayload bool
+}
+
+type stdLogger struct {
+	out    io.Writer
+	lock   *sync.Mutex
+	config LoggerConfig
+	fields []Field
+}
+
+// NewLogger create logger writing to out
+func NewLogger(out io.Writer, config LoggerConfig) Logger {
+	return &stdLogger{
+		out:    out,
+		lock:   &sync.Mutex{},
+		config: config,
+	}
+}
+
+// DefaultLogger text logger at info level writing to stdout
+var DefaultLogger = NewLogger(os.Stdout, LoggerConfig{Level: LevelInfo})
+
+// NopLogger discard everything
+var NopLogger Logger = nopLogger{}
+
+func (l *stdLogger) With(fields ...Field) Logger {
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+	return &stdLogger{
+		out:    l.out,
+		lock:   l.lock,
+		config: l.config,
+		fields: all,
+	}
+}
+
+func (l *stdLogger) Debug(msg string, fields ...Field) {
+	l.log(LevelDebug, msg, fields)
+}
+
+func (l *stdLogger) Info(msg string, fields ...Field) {
+	l.log(LevelInfo, msg, fields)
+}
+
+func (l *stdLogger) Warn(msg string, fields ...Field) {
+	l.log(LevelWarn, msg, fields)
+}
+
+func (l *stdLogger) Error(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+}
+
+func (l *stdLogger) log(level LogLevel, msg string, fields []Field) {
+	if level < l.config.Level {
+		return
+	}
+
+	now := time.Now().Format("2006-01-02T15:04:05.000Z07:00")
+	buf := &bytes.Buffer{}
+	if l.config.JSON {
+		buf.WriteString(`{"time":"` + now + `","level":"` + level.String() + `","msg":`)
+		writeJSONValue(buf, msg)
+		for _, f := range l.fields {
+			l.writeJSONField(buf, f)
+		}
+		for _, f := range fields {
+			l.writeJSONField(buf, f)
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now + " " + level.String() + " " + msg)
+		for _, f := range l.fields {
+			l.writeTextField(buf, f)
+		}
+		for _, f := range fields {
+			l.writeTextField(buf, f)
+		}
+		buf.WriteByte('\n')
+	}
+
+	l.lock.Lock()
+	l.out.Write(buf.Bytes())
+	l.lock.Unlock()
+}
+
+func (l *stdLogger) value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case payload:
+		if l.config.LogPayload {
+			return string(t)
+		}
+		return "[redacted " + strconv.Itoa(len(t)) + " bytes]"
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+func (l *stdLogger) writeJSONField(buf *bytes.Buffer, f Field) {
+	buf.WriteByte(',')
+	writeJSONValue(buf, f.Key)
+	buf.WriteByte(':')
+	writeJSONValue(buf, l.value(f.Value))
+}
+
+func (l *stdLogger) writeTextField(buf *bytes.Buffer, f Field) {
+	buf.WriteString(" " + f.Key + "=")
+	s := fmt.Sprint(l.value(f.Value))
+	if strings.ContainsAny(s, " \"=\n") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...Field) {}
+func (nopLogger) Info(msg string, fields ...Field)  {}
+func (nopLogger) Warn(msg string, fields ...Field)  {}
+func (nopLogger) Error(msg string, fields ...Field) {}
+func (n nopLogger) With(fields ...Field) Logger     { return n }
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoggerText(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out, LoggerConfig{Level: LevelInfo}).With(F("app", "test"))
+
+	logger.Debug("Hidden")
+	logger.Info("Started", F("port", 8080), F("error", errors.New("no such host")), F("name", `a "b"`))
+	line := out.String()
+	if !regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}\S+ INFO Started `).MatchString(line) {
+		t.Fatalf("line = %q, want time, level & message", line)
+	}
+	want := ` app=test port=8080 error="no such host" name="a \"b\""` + "\n"
+	if !strings.HasSuffix(line, want) {
+		t.Fatalf("line = %q, want fields %q", line, want)
+	}
+	if strings.Contains(line, "Hidden") {
+		t.Fatalf("debug entry written at info level: %q", line)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out, LoggerConfig{Level: LevelDebug, JSON: true}).With(F("app", "test"))
+	logger.Warn("Line\nbreak", F("count", 3), F("error", &Error{Type: "FAILED", Message: "Failed."}))
+
+	var entry struct {
+		Time  string
+		Level string
+		Msg   string
+		App   string
+		Count int
+		Error string
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("line %q is not json: %v", out.String(), err)
+	}
+	if entry.Time == "" || entry.Level != "WARN" || entry.Msg != "Line\nbreak" || entry.App != "test" ||
+		entry.Count != 3 || entry.Error != "FAILED : Failed." {
+		t.Fatalf("entry = %+v", entry)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Fatalf("entry = %q, want one line", out.String())
+	}
+}
+
+func TestLoggerPayload(t *testing.T) {
+	tests := []struct {
+		config LoggerConfig
+		want   string
+	}{
+		{LoggerConfig{}, `body="[redacted 6 bytes]"`},
+		{LoggerConfig{LogPayload: true}, `body=secret`},
+		{LoggerConfig{JSON: true}, `"body":"[redacted 6 bytes]"`},
+		{LoggerConfig{JSON: true, LogPayload: true}, `"body":"secret"`},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		NewLogger(&out, tt.config).Info("Request", Payload("body", []byte("secret")))
+		if !strings.Contains(out.String(), tt.want) {
+			t.Fatalf("%+v: line = %q, want %s", tt.config, out.String(), tt.want)
+		}
+	}
+}
+
+func TestAppLoggerWiring(t *testing.T) {
+	var out logBuffer
+	app := NewApp("test")
+	app.SetLogger(NewLogger(&out, LoggerConfig{Level: LevelInfo}))
+
+	queue := &DBQueue2{ColName: "jobs"}
+	app.AddQueue(queue)
+	queue.log().Info("From queue")
+	cache := &DBCache{ColName: "entries"}
+	app.AddDBCache(cache)
+	cache.log().Info("From cache")
+
+	for _, msg := range []string{"From queue", "From cache"} {
+		if !regexp.MustCompile(msg + ` app=test host=\S+`).MatchString(out.String()) {
+			t.Fatalf("logs = %s, want %q with app & host", out.String(), msg)
+		}
+	}
+
+	// a component with its own logger keeps it
+	own := NewLogger(&out, LoggerConfig{})
+	queue = &DBQueue2{ColName: "other"}
+	queue.SetLogger(own)
+	app.AddQueue(queue)
+	if queue.log() != own {
+		t.Fatal("AddQueue replaced the logger of the queue")
+	}
+}
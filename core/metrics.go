@@ -0,0 +1,376 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefBuckets default histogram buckets (second)
+var DefBuckets = []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// MetricRegistry hold metrics & render them in Prometheus text format
+type MetricRegistry struct {
+	metrics []collector
+	lock    *sync.Mutex
+}
+
+// NewMetricRegistry ...
+func NewMetricRegistry() *MetricRegistry {
+	return &MetricRegistry{lock: &sync.Mutex{}}
+}
+
+func (r *MetricRegistry) register(c collector) {
+	r.lock.Lock()
+	r.metrics = append(r.metrics, c)
+	r.lock.Unlock()
+}
+
+// NewCounter ...
+func (r *MetricRegistry) NewCounter(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// NewGauge ...
+func (r *MetricRegistry) NewGauge(name string, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// NewGaugeFunc gauge which value is read from fn on every scrape
+func (r *MetricRegistry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(&gaugeFunc{name: name, help: help, fn: fn})
+}
+
+// NewHistogram buckets = nil means DefBuckets
+func (r *MetricRegistry) NewHistogram(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// WritePrometheus write all metrics in Prometheus text exposition format
+func (r *MetricRegistry) WritePrometheus(w io.Writer) error {
+	r.lock.Lock()
+	metrics := make([]collector, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.lock.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP expose metrics as http handler
+func (r *MetricRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WritePrometheus(w)
+}
+
+// ListenAndServe start an http server exposing metrics at /metrics
+func (r *MetricRegistry) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	return http.ListenAndServe(addr, mux)
+}
+
+// vec children of one metric, keyed by label values
+type vec struct {
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	children map[string]interface{}
+	lock     *sync.RWMutex
+}
+
+func newVec(name string, help string, kind string, labels []string) vec {
+	return vec{
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		children: make(map[string]interface{}),
+		lock:     &sync.RWMutex{},
+	}
+}
+
+func (v *vec) child(values []string, create func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(Error{Type: "INVALID_LABELS", Message: "Metric " + v.name + " require " + strconv.Itoa(len(v.labels)) + " label values."})
+	}
+	key := v.labelString(values)
+
+	v.lock.RLock()
+	c, ok := v.children[key]
+	v.lock.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if c, ok = v.children[key]; !ok {
+		c = create()
+		v.children[key] = c
+	}
+	return c
+}
+
+// labelString render {a="x",b="y"}
+func (v *vec) labelString(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range v.labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(values[i]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + v.name + " " + v.help + "\n")
+	w.WriteString("# TYPE " + v.name + " " + v.kind + "\n")
+}
+
+func (v *vec) sortedKeys() []string {
+	v.lock.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	v.lock.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) get(key string) interface{} {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.children[key]
+}
+
+func escapeLabel(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// atomicFloat float64 stored as bits
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		nw := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&f.bits, old, nw) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter monotonic increasing value
+type Counter struct {
+	v atomicFloat
+}
+
+// Inc ...
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add delta must not be negative
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.Add(delta)
+}
+
+// Value ...
+func (c *Counter) Value() float64 {
+	return c.v.Value()
+}
+
+// CounterVec ...
+type CounterVec struct {
+	vec
+}
+
+// With get counter of label values
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.child(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	for _, k := range c.sortedKeys() {
+		w.WriteString(c.name + k + " " + formatFloat(c.get(k).(*Counter).Value()) + "\n")
+	}
+}
+
+// Gauge value can go up and down
+type Gauge struct {
+	v atomicFloat
+}
+
+// Set ...
+func (g *Gauge) Set(v float64) {
+	g.v.Set(v)
+}
+
+// Inc ...
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+// Dec ...
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+// Add ...
+func (g *Gauge) Add(delta float64) {
+	g.v.Add(delta)
+}
+
+// Value ...
+func (g *Gauge) Value() float64 {
+	return g.v.Value()
+}
+
+// GaugeVec ...
+type GaugeVec struct {
+	vec
+}
+
+// With get gauge of label values
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.child(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	for _, k := range g.sortedKeys() {
+		w.WriteString(g.name + k + " " + formatFloat(g.get(k).(*Gauge).Value()) + "\n")
+	}
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	w.WriteString("# HELP " + g.name + " " + g.help + "\n")
+	w.WriteString("# TYPE " + g.name + " gauge\n")
+	w.WriteString(g.name + " " + formatFloat(g.fn()) + "\n")
+}
+
+// Histogram count observations into buckets
+type Histogram struct {
+	upper  []float64
+	counts []uint64
+	count  uint64
+	sum    atomicFloat
+}
+
+// Observe ...
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	atomic.AddUint64(&h.count, 1)
+	h.sum.Add(v)
+}
+
+// ObserveSince observe duration from start in second
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramVec ...
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// With get histogram of label values
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.child(values, func() interface{} {
+		return &Histogram{upper: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	for _, k := range h.sortedKeys() {
+		hist := h.get(k).(*Histogram)
+
+		// labels of bucket lines have one more "le" label
+		prefix := "{"
+		if k != "" {
+			prefix = k[:len(k)-1] + ","
+		}
+
+		var cumulative uint64
+		for i, upper := range hist.upper {
+			cumulative += atomic.LoadUint64(&hist.counts[i])
+			w.WriteString(h.name + "_bucket" + prefix + `le="` + formatFloat(upper) + `"} ` + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		count := atomic.LoadUint64(&hist.count)
+		w.WriteString(h.name + "_bucket" + prefix + `le="+Inf"} ` + strconv.FormatUint(count, 10) + "\n")
+		w.WriteString(h.name + "_sum" + k + " " + formatFloat(hist.sum.Value()) + "\n")
+		w.WriteString(h.name + "_count" + k + " " + strconv.FormatUint(count, 10) + "\n")
+	}
+}
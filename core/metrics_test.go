@@ -0,0 +1,95 @@
+package core
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+		{`\"` + "\n", `\\\"\n`},
+	}
+	for _, tt := range tests {
+		if got := escapeLabel(tt.in); got != tt.want {
+			t.Fatalf("escapeLabel(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{0.25, "0.25"},
+		{3, "3"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.in); got != tt.want {
+			t.Fatalf("formatFloat(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewMetricRegistry()
+	requests := r.NewCounter("test_requests_total", "Number of requests.", "action", "status")
+	requests.With(`say "hi"`, "OK").Add(2)
+	requests.With("a\\b\nc", "ERROR").Inc()
+	r.NewGauge("test_connections", "Open connections.").With().Set(3)
+	latency := r.NewHistogram("test_duration_seconds", "Latency.", []float64{0.1, 1}, "action")
+	latency.With("get").Observe(0.05)
+	latency.With("get").Observe(0.5)
+	latency.With("get").Observe(5)
+	r.NewHistogram("test_size", "Size.", []float64{1}).With().Observe(0.5)
+
+	var out strings.Builder
+	if err := r.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{action="a\\b\nc",status="ERROR"} 1
+test_requests_total{action="say \"hi\"",status="OK"} 2
+# HELP test_connections Open connections.
+# TYPE test_connections gauge
+test_connections 3
+# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{action="get",le="0.1"} 1
+test_duration_seconds_bucket{action="get",le="1"} 2
+test_duration_seconds_bucket{action="get",le="+Inf"} 3
+test_duration_seconds_sum{action="get"} 5.55
+test_duration_seconds_count{action="get"} 3
+# HELP test_size Size.
+# TYPE test_size histogram
+test_size_bucket{le="1"} 1
+test_size_bucket{le="+Inf"} 1
+test_size_sum 0.5
+test_size_count 1
+`
+	if out.String() != want {
+		t.Fatalf("WritePrometheus() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestMetricLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("With() of missing label values did not panic")
+		}
+	}()
+	NewMetricRegistry().NewCounter("test_total", "Test.", "action").With()
+}
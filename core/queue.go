@@ -1,11 +1,12 @@
 package core
 
 import (
-	"fmt"
+	"context"
 	"math/rand"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/globalsign/mgo"
@@ -102,6 +103,8 @@ func (c *DBQueueChannel) putItem(item *QueueItem) bool {
 
 // DBQueueConnector ...
 type DBQueueConnector struct {
+	heartbeat int64 // unix nano of last loop iteration
+
 	name     string
 	channels []*DBQueueChannel
 	queueDB  *DBModel
@@ -127,23 +130,29 @@ func (dbc *DBQueueConnector) pickFreeChannel(start int, limit int) int {
 	return -1
 }
 
+// waitFreeChannel pick a free channel from start, waiting while all channels are busy.
+// Busy channels are a loaded consumer, not a stuck one: the heartbeat goes on while waiting.
+func (dbc *DBQueueConnector) waitFreeChannel(start int) int {
+	for {
+		picked := dbc.pickFreeChannel(start, len(dbc.channels))
+		if picked >= 0 {
+			return picked
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt64(&dbc.heartbeat, time.Now().UnixNano())
+	}
+}
+
 func (dbc *DBQueueConnector) start() {
 	var channelNum = len(dbc.channels)
 	var i = 0
 	var counter = 0
 	for true {
+		atomic.StoreInt64(&dbc.heartbeat, time.Now().UnixNano())
 
 		// pick channel
-		picked := -1
-		for picked < 0 {
-			picked = dbc.pickFreeChannel(i, channelNum)
-			if picked >= 0 {
-				i = (picked + 1) % channelNum
-			} else {
-				// if all channels are busy
-				time.Sleep(10 * time.Millisecond)
-			}
-		}
+		picked := dbc.waitFreeChannel(i)
+		i = (picked + 1) % channelNum
 
 		// pick one item in queue
 		resp := dbc.queueDB.UpdateOne(&bson.M{
@@ -212,6 +221,32 @@ type DBQueue2 struct {
 	channels   []*DBQueueChannel
 	connector  *DBQueueConnector
 	hostname   string
+	logger     Logger
+	lock       sync.Mutex
+}
+
+// Depth number of items waiting or being processed
+func (dbq *DBQueue2) Depth() (int64, error) {
+	if !dbq.ready {
+		return 0, &Error{Type: "NOT_INITED", Message: "Require to init database before using queue."}
+	}
+	resp := dbq.queueDB.Count(bson.M{})
+	if resp.Status != DbStatus.Ok {
+		return 0, &Error{Type: resp.ErrorCode, Message: resp.Message}
+	}
+	return resp.Total, nil
+}
+
+// SetLogger ...
+func (dbq *DBQueue2) SetLogger(logger Logger) {
+	dbq.logger = logger
+}
+
+func (dbq *DBQueue2) log() Logger {
+	if dbq.logger == nil {
+		return DefaultLogger
+	}
+	return dbq.logger
 }
 
 // Init ...
@@ -300,17 +335,48 @@ func (dbq *DBQueue2) startConnectors() {
 	// wait some time for all channels inited
 	time.Sleep(3 * time.Second)
 
-	dbq.connector = &DBQueueConnector{
-		name:     dbq.hostname + "/connector",
-		queueDB:  dbq.queueDB,
-		channels: dbq.channels,
+	connector := &DBQueueConnector{
+		heartbeat: time.Now().UnixNano(),
+		name:      dbq.hostname + "/connector",
+		queueDB:   dbq.queueDB,
+		channels:  dbq.channels,
 	}
 
-	dbq.connector.version = os.Getenv("version")
-	if dbq.connector.version == "" {
-		dbq.connector.version = strconv.Itoa((1000000 + rand.Int()) % 999999)
+	connector.version = Version()
+	if connector.version == "" {
+		connector.version = strconv.Itoa((1000000 + rand.Int()) % 999999)
+	}
+
+	dbq.lock.Lock()
+	dbq.connector = connector
+	dbq.lock.Unlock()
+	go connector.start()
+}
+
+// connectorStuckAfter connector without progress for this long is reported unhealthy
+const connectorStuckAfter = 2 * time.Minute
+
+// HealthCheck fail if consumer is started but its connector stopped picking items
+func (dbq *DBQueue2) HealthCheck(ctx context.Context) error {
+	if !dbq.ready {
+		return &Error{Type: "NOT_INITED", Message: "Queue " + dbq.ColName + " is not inited."}
+	}
+	if len(dbq.channels) == 0 {
+		// producer only
+		return nil
+	}
+	dbq.lock.Lock()
+	connector := dbq.connector
+	dbq.lock.Unlock()
+	if connector == nil {
+		// connector starts a few seconds after consumers
+		return nil
+	}
+	last := time.Unix(0, atomic.LoadInt64(&connector.heartbeat))
+	if time.Since(last) > connectorStuckAfter {
+		return &Error{Type: "STUCK", Message: "Queue " + dbq.ColName + " connector has not progressed since " + last.Format(time.RFC3339) + "."}
 	}
-	go dbq.connector.start()
+	return nil
 }
 
 func (dbq *DBQueue2) Push(data interface{}) error {
@@ -333,6 +399,6 @@ func (dbq *DBQueue2) PushWithKey(data interface{}, keys *[]string) error {
 		return nil
 	}
 
-	fmt.Println("Push to queue" + resp.Status)
+	dbq.log().Error("Push to queue failed", F("collection", dbq.ColName), F("status", resp.Status), F("error", resp.Message))
 	return &Error{Type: resp.ErrorCode, Message: resp.Message}
 }
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConsumer queue with started consumer, its connector last progressed at heartbeat
+func testConsumer(channels int, busy bool, heartbeat time.Time) *DBQueue2 {
+	q := &DBQueue2{ColName: "test", ready: true}
+	for i := 0; i < channels; i++ {
+		q.channels = append(q.channels, &DBQueueChannel{processing: busy, lock: &sync.Mutex{}})
+	}
+	q.connector = &DBQueueConnector{heartbeat: heartbeat.UnixNano(), channels: q.channels}
+	return q
+}
+
+func TestQueueHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	if err := (&DBQueue2{ColName: "test"}).HealthCheck(ctx); err == nil {
+		t.Fatal("HealthCheck() of a queue not inited = nil")
+	}
+	if err := (&DBQueue2{ColName: "test", ready: true}).HealthCheck(ctx); err != nil {
+		t.Fatalf("HealthCheck() of a producer = %v", err)
+	}
+	if err := testConsumer(2, false, time.Now()).HealthCheck(ctx); err != nil {
+		t.Fatalf("HealthCheck() of a progressing consumer = %v", err)
+	}
+	err := testConsumer(2, false, time.Now().Add(-2*connectorStuckAfter)).HealthCheck(ctx)
+	if e, ok := err.(*Error); !ok || e.Type != "STUCK" {
+		t.Fatalf("HealthCheck() of a stuck connector = %v, want STUCK", err)
+	}
+}
+
+func TestQueueHealthCheckAllChannelsBusy(t *testing.T) {
+	q := testConsumer(2, true, time.Now().Add(-2*connectorStuckAfter))
+	// no channel is ever freed, the connector waits for good like under a long full load
+	go q.connector.waitFreeChannel(0)
+	if !waitFor(time.Second, func() bool { return q.HealthCheck(context.Background()) == nil }) {
+		t.Fatalf("HealthCheck() while all channels are busy = %v, want healthy", q.HealthCheck(context.Background()))
+	}
+	if last := time.Unix(0, atomic.LoadInt64(&q.connector.heartbeat)); time.Since(last) > time.Second {
+		t.Fatalf("heartbeat %s not refreshed while waiting", last)
+	}
+}
+
+func TestWaitFreeChannel(t *testing.T) {
+	q := testConsumer(3, false, time.Now())
+	q.channels[1].processing = true
+	if i := q.connector.waitFreeChannel(1); i != 2 {
+		t.Fatalf("waitFreeChannel(1) = %d, want 2", i)
+	}
+	if !q.channels[2].processing {
+		t.Fatal("picked channel not marked processing")
+	}
+	if i := q.connector.waitFreeChannel(1); i != 0 {
+		t.Fatalf("waitFreeChannel(1) = %d, want 0 after wrapping", i)
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 type Request struct {
-	Action string
-	Data   interface{}
+	Action  string
+	Data    interface{}
+	TraceID string `json:",omitempty"`
 }
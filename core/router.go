@@ -0,0 +1,201 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Wildcard match every action under a namespace, e.g "order.*", or every action if used alone
+const Wildcard = "*"
+
+// Router dispatch actions to handlers by exact name, then by the longest wildcard namespace,
+// then to the not-found handler
+type Router struct {
+	exact     map[string]*Handler
+	wildcards map[string]*Handler // keyed by prefix, "order." for "order.*"
+	notFound  *Handler
+	lock      *sync.RWMutex
+}
+
+// HandlerInfo describe a registered action
+type HandlerInfo struct {
+	Action      string            `json:"action"`
+	Description string            `json:"description,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Wildcard    bool              `json:"wildcard,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+// NewRouter ...
+func NewRouter() *Router {
+	return &Router{
+		exact:     make(map[string]*Handler),
+		wildcards: make(map[string]*Handler),
+		lock:      &sync.RWMutex{},
+	}
+}
+
+// SetHandle register handler, action ending with "*" is a wildcard
+func (r *Router) SetHandle(action string, fn HandleFunc) *Handler {
+	h := &Handler{Action: action, Fn: fn}
+	r.lock.Lock()
+	if strings.HasSuffix(action, Wildcard) {
+		r.wildcards[strings.TrimSuffix(action, Wildcard)] = h
+	} else {
+		r.exact[action] = h
+	}
+	r.lock.Unlock()
+	return h
+}
+
+// SetNotFound handler used when no action matched
+func (r *Router) SetNotFound(fn HandleFunc) *Handler {
+	h := &Handler{Action: "", Fn: fn}
+	r.lock.Lock()
+	r.notFound = h
+	r.lock.Unlock()
+	return h
+}
+
+// Group create namespace, actions registered in group are prefixed by "name."
+func (r *Router) Group(name string) *Group {
+	return &Group{router: r, prefix: name + "."}
+}
+
+// Match find handler of action, nil if nothing matched & no not-found handler
+func (r *Router) Match(action string) *Handler {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if h, ok := r.exact[action]; ok {
+		return h
+	}
+
+	var matched *Handler
+	longest := -1
+	for prefix, h := range r.wildcards {
+		if len(prefix) > longest && strings.HasPrefix(action, prefix) {
+			matched = h
+			longest = len(prefix)
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	return r.notFound
+}
+
+// Actions list registered actions sorted by name
+func (r *Router) Actions() []HandlerInfo {
+	r.lock.RLock()
+	list := make([]HandlerInfo, 0, len(r.exact)+len(r.wildcards))
+	for _, h := range r.exact {
+		list = append(list, h.info())
+	}
+	for _, h := range r.wildcards {
+		list = append(list, h.info())
+	}
+	r.lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Action < list[j].Action
+	})
+	return list
+}
+
+// Group namespace of actions
+type Group struct {
+	router *Router
+	prefix string
+}
+
+// SetHandle register "prefix.name", name "*" match every action of the group
+func (g *Group) SetHandle(name string, fn HandleFunc) *Handler {
+	return g.router.SetHandle(g.prefix+name, fn)
+}
+
+// Group create nested namespace
+func (g *Group) Group(name string) *Group {
+	return &Group{router: g.router, prefix: g.prefix + name + "."}
+}
+
+// Handler registered handler of an action
+type Handler struct {
+	Action      string
+	Fn          HandleFunc
+	description string
+	timeout     time.Duration
+	meta        map[string]string
+	lock        sync.RWMutex
+}
+
+// SetTimeout cancel handler context after timeout, 0 means no timeout
+func (h *Handler) SetTimeout(timeout time.Duration) *Handler {
+	h.lock.Lock()
+	h.timeout = timeout
+	h.lock.Unlock()
+	return h
+}
+
+// Timeout ...
+func (h *Handler) Timeout() time.Duration {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.timeout
+}
+
+// SetDescription describe the action in Router.Actions
+func (h *Handler) SetDescription(desc string) *Handler {
+	h.lock.Lock()
+	h.description = desc
+	h.lock.Unlock()
+	return h
+}
+
+// Description ...
+func (h *Handler) Description() string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.description
+}
+
+// SetMeta attach metadata listed by Router.Actions
+func (h *Handler) SetMeta(key string, value string) *Handler {
+	h.lock.Lock()
+	if h.meta == nil {
+		h.meta = map[string]string{}
+	}
+	h.meta[key] = value
+	h.lock.Unlock()
+	return h
+}
+
+// Meta ...
+func (h *Handler) Meta(key string) string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.meta[key]
+}
+
+func (h *Handler) info() HandlerInfo {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	info := HandlerInfo{
+		Action:      h.Action,
+		Description: h.description,
+		Wildcard:    strings.HasSuffix(h.Action, Wildcard),
+	}
+	if h.timeout > 0 {
+		info.Timeout = h.timeout.String()
+	}
+	if len(h.meta) > 0 {
+		info.Meta = make(map[string]string, len(h.meta))
+		for k, v := range h.meta {
+			info.Meta[k] = v
+		}
+	}
+	return info
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testRouter() *Router {
+	r := NewRouter()
+	for _, action := range []string{"ping", "order.get", "order.*", "order.item.*", "*"} {
+		r.SetHandle(action, nil)
+	}
+	return r
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := testRouter()
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{"ping", "ping"},
+		{"order.get", "order.get"},
+		{"order.list", "order.*"},
+		{"order.item.add", "order.item.*"},
+		{"order.item", "order.*"},
+		{"order", "*"},
+		{"other.get", "*"},
+		{"", "*"},
+	}
+	for _, tt := range tests {
+		h := r.Match(tt.action)
+		if h == nil || h.Action != tt.want {
+			t.Fatalf("Match(%q) = %v, want %s", tt.action, h, tt.want)
+		}
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	r := NewRouter()
+	r.SetHandle("order.*", nil)
+	if h := r.Match("ping"); h != nil {
+		t.Fatalf("Match() without not-found handler = %v, want nil", h)
+	}
+	nf := r.SetNotFound(func(ctx context.Context, request Request) Response {
+		return Response{Status: APIStatus.NotFound}
+	})
+	if h := r.Match("ping"); h != nf {
+		t.Fatalf("Match() = %v, want the not-found handler", h)
+	}
+	if h := r.Match("order.get"); h == nf {
+		t.Fatal("not-found handler preferred over a wildcard")
+	}
+	// the not-found handler is not an action
+	if list := r.Actions(); len(list) != 1 {
+		t.Fatalf("Actions() = %v, want only order.*", list)
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	r := NewRouter()
+	order := r.Group("order")
+	order.SetHandle("get", nil)
+	order.Group("item").SetHandle("*", nil)
+	order.SetHandle("*", nil)
+
+	for action, want := range map[string]string{
+		"order.get":      "order.get",
+		"order.item.add": "order.item.*",
+		"order.delete":   "order.*",
+	} {
+		if h := r.Match(action); h == nil || h.Action != want {
+			t.Fatalf("Match(%q) = %v, want %s", action, h, want)
+		}
+	}
+	if h := r.Match("get"); h != nil {
+		t.Fatalf("Match() of a group action without prefix = %v, want nil", h)
+	}
+}
+
+func TestRouterActions(t *testing.T) {
+	r := testRouter()
+	r.Match("order.get").SetDescription("Get an order.").SetTimeout(time.Second).SetMeta("owner", "team")
+	// replace keeps one entry
+	r.SetHandle("ping", nil).SetDescription("Ping.")
+
+	list := r.Actions()
+	want := []string{"*", "order.*", "order.get", "order.item.*", "ping"}
+	if len(list) != len(want) {
+		t.Fatalf("Actions() = %v, want %v", list, want)
+	}
+	for i, info := range list {
+		if info.Action != want[i] {
+			t.Fatalf("Actions()[%d] = %s, want %s", i, info.Action, want[i])
+		}
+	}
+	get := list[2]
+	if get.Description != "Get an order." || get.Timeout != "1s" || get.Meta["owner"] != "team" || get.Wildcard {
+		t.Fatalf("order.get info = %+v", get)
+	}
+	if !list[1].Wildcard || list[4].Description != "Ping." {
+		t.Fatalf("Actions() = %+v", list)
+	}
+	if d := r.Match("order.get").Description(); d != "Get an order." {
+		t.Fatalf("Description() = %q", d)
+	}
+}
@@ -2,37 +2,132 @@ package core
 
 import (
 	"bytes"
-	"fmt"
-	"log"
+	"context"
 	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/binhgo/foosee/util"
+	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 )
 
-type HandleFunc func(request Request) Response
+// HandleFunc handler of an action, ctx is done when the handler times out, its connection closes or
+// the server stops. The next request of the connection is served after the handler returns,
+// so handlers must return once ctx is done.
+type HandleFunc func(ctx context.Context, request Request) Response
+
+type job struct {
+	handler *Handler
+	req     Request
+}
+
+// serverMetrics ...
+type serverMetrics struct {
+	activeConns *GaugeVec
+	framesIn    *CounterVec
+	framesOut   *CounterVec
+	bytesIn     *CounterVec
+	bytesOut    *CounterVec
+	requests    *CounterVec
+	latency     *HistogramVec
+	pollWait    *HistogramVec
+}
+
+func newServerMetrics(r *MetricRegistry, s *Server) *serverMetrics {
+	r.NewGaugeFunc("foosee_dispatch_queue_depth", "Number of requests waiting for a dispatcher.", func() float64 {
+		return float64(atomic.LoadInt64(&s.pending))
+	})
+	return &serverMetrics{
+		activeConns: r.NewGauge("foosee_active_connections", "Number of open websocket connections."),
+		framesIn:    r.NewCounter("foosee_frames_in_total", "Number of frames read from clients."),
+		framesOut:   r.NewCounter("foosee_frames_out_total", "Number of frames written to clients."),
+		bytesIn:     r.NewCounter("foosee_bytes_in_total", "Bytes read from clients."),
+		bytesOut:    r.NewCounter("foosee_bytes_out_total", "Bytes written to clients."),
+		requests:    r.NewCounter("foosee_requests_total", "Number of handled requests by action and status.", "action", "status"),
+		latency:     r.NewHistogram("foosee_request_duration_seconds", "Handler latency by action.", nil, "action"),
+		pollWait:    r.NewHistogram("foosee_poll_wait_seconds", "Duration of poller wait calls.", nil),
+	}
+}
+
+// serverStuckAfter poll loop without progress for this long is reported unhealthy
+const serverStuckAfter = 30 * time.Second
 
 type Server struct {
+	heartbeat int64 // unix nano of last poll loop iteration
+	pending   int64 // requests waiting for a dispatcher
+	running   int32
+
 	Poll        IPoll
 	PollTimeout int64
-	handlers    map[string]HandleFunc
+	Metrics     *MetricRegistry
+	metrics     *serverMetrics
+	Router      *Router
+	logger      Logger
+	services    *Services
+	conns       map[net.Conn]*Connection
+	lock        *sync.RWMutex
+	ready       chan *Connection // connections with pending requests
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 func NewServer(kqTimeout int64) *Server {
+	return newServer(kqTimeout, NewMetricRegistry())
+}
+
+// newServer server exporting its metrics to registry
+func newServer(kqTimeout int64, registry *MetricRegistry) *Server {
 	kq := NewKQueue()
-	return &Server{
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
 		Poll:        kq,
 		PollTimeout: kqTimeout,
-		handlers:    make(map[string]HandleFunc),
+		Metrics:     registry,
+		Router:      NewRouter(),
+		logger:      DefaultLogger,
+		conns:       make(map[net.Conn]*Connection),
+		lock:        &sync.RWMutex{},
+		ready:       make(chan *Connection, 1024),
+		ctx:         ctx,
+		cancel:      cancel,
 	}
+	s.metrics = newServerMetrics(s.Metrics, s)
+	return s
+}
+
+// SetLogger ...
+func (s *Server) SetLogger(logger Logger) *Server {
+	s.logger = logger
+	return s
+}
+
+// SetServices registry handed to handlers, see ServicesFromContext
+func (s *Server) SetServices(services *Services) *Server {
+	s.services = services
+	return s
 }
 
 func (s *Server) Start() {
 
-	for {
+	for i := 0; i < runtime.NumCPU()*4; i++ {
+		go s.dispatcher()
+	}
+
+	atomic.StoreInt32(&s.running, 1)
+	defer atomic.StoreInt32(&s.running, 0)
+
+	for s.ctx.Err() == nil {
+		start := time.Now()
+		atomic.StoreInt64(&s.heartbeat, start.UnixNano())
 		conns, err := s.Poll.Wait(s.PollTimeout)
+		s.metrics.pollWait.With().ObserveSince(start)
 		if err != nil {
-			fmt.Printf("Failed to epoll wait %v", err)
+			s.logger.Error("Failed to wait poller", F("error", err))
 			continue
 		}
 
@@ -46,57 +141,332 @@ func (s *Server) Start() {
 	}
 }
 
+// HealthCheck fail if the poll loop is not running or stuck
+func (s *Server) HealthCheck(ctx context.Context) error {
+	if s.Poll == nil {
+		return &Error{Type: "NOT_INITED", Message: "Server has no poller."}
+	}
+	if atomic.LoadInt32(&s.running) == 0 {
+		return &Error{Type: "NOT_RUNNING", Message: "Poll loop is not running."}
+	}
+	last := time.Unix(0, atomic.LoadInt64(&s.heartbeat))
+	if time.Since(last) > serverStuckAfter {
+		return &Error{Type: "STUCK", Message: "Poll loop has not progressed since " + last.Format(time.RFC3339) + "."}
+	}
+	return nil
+}
+
+// Stop cancel context of all running handlers and close all connections
+func (s *Server) Stop() {
+	s.cancel()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for conn, c := range s.conns {
+		s.Poll.Remove(conn)
+		c.close()
+		delete(s.conns, conn)
+		s.metrics.activeConns.With().Dec()
+	}
+}
+
+// AddConn register an upgraded websocket connection to the poller
+func (s *Server) AddConn(conn net.Conn) (*Connection, error) {
+	err := s.Poll.Add(conn)
+	if err != nil {
+		return nil, err
+	}
+	c := s.connection(conn)
+	s.logger.Debug("Connection added", F("conn", c.ID))
+	return c, nil
+}
+
+// ServeHTTP upgrade http request to websocket & add the connection
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		return
+	}
+
+	if _, err = s.AddConn(conn); err != nil {
+		s.logger.Warn("Failed to add connection", F("error", err))
+		conn.Close()
+	}
+}
+
+// Connections list open connections ordered by id
+func (s *Server) Connections() []ConnectionInfo {
+	s.lock.RLock()
+	list := make([]*Connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		list = append(list, c)
+	}
+	s.lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ConnectedAt.Before(list[j].ConnectedAt)
+	})
+	infos := make([]ConnectionInfo, 0, len(list))
+	for _, c := range list {
+		infos = append(infos, c.Info())
+	}
+	return infos
+}
+
+// Disconnect close connection by id
+func (s *Server) Disconnect(id string) error {
+	c := s.connectionByID(id)
+	if c == nil {
+		return &Error{Type: "NOT_FOUND", Message: "Not found connection " + id + "."}
+	}
+	return s.RemoveConn(c.Conn)
+}
+
+func (s *Server) connectionByID(id string) *Connection {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, c := range s.conns {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// RemoveConn unregister & close connection, handlers of the connection are cancelled
+func (s *Server) RemoveConn(conn net.Conn) error {
+	err := s.Poll.Remove(conn)
+
+	s.lock.Lock()
+	c, ok := s.conns[conn]
+	delete(s.conns, conn)
+	s.lock.Unlock()
+
+	if ok {
+		s.metrics.activeConns.With().Dec()
+		s.logger.Debug("Connection removed", F("conn", c.ID))
+		c.close()
+	} else {
+		conn.Close()
+	}
+	return err
+}
+
+// connection get state of conn, create new one if conn was added directly to Poll
+func (s *Server) connection(conn net.Conn) *Connection {
+	s.lock.RLock()
+	c, ok := s.conns[conn]
+	s.lock.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c, ok = s.conns[conn]; !ok {
+		c = newConnection(s.ctx, conn)
+		s.conns[conn] = c
+		s.metrics.activeConns.With().Inc()
+	}
+	return c
+}
+
 func (s *Server) Process(conn net.Conn) {
 
 	msg, _, err := wsutil.ReadClientData(conn)
 	if err != nil {
-		if err := s.Poll.Remove(conn); err != nil {
-			log.Printf("Failed to remove %v", err)
+		if err := s.RemoveConn(conn); err != nil {
+			s.logger.Warn("Failed to remove connection", F("error", err))
 		}
-		conn.Close()
+		return
 	}
 
-	fmt.Println(string(msg))
+	s.metrics.framesIn.With().Inc()
+	s.metrics.bytesIn.With().Add(float64(len(msg)))
 
+	c := s.connection(conn)
 	req := Request{}
 	err = util.FromJson(msg, &req)
 
 	bb := bytes.Buffer{}
 
 	if err != nil {
+		s.logger.Warn("Failed to parse request", F("conn", c.ID), F("error", err), Payload("body", msg))
 		bb.WriteString("ERROR PARSE REQUEST: [")
 		bb.WriteString(string(msg))
 		bb.WriteString("]")
 
-		wsutil.WriteServerText(conn, bb.Bytes())
+		s.write(c, bb.Bytes())
 		return
 	}
 
 	// process data
-	handleFunc := s.GetHandler(req.Action)
-	if handleFunc == nil {
+	handler := s.Router.Match(req.Action)
+	if handler == nil {
 		bb.WriteString("NO HANDLER for METHOD: [")
 		bb.WriteString(req.Action)
 		bb.WriteString("]")
 
-		wsutil.WriteServerText(conn, bb.Bytes())
+		s.countRequest(notFoundLabel, "NO_HANDLER")
+		s.write(c, bb.Bytes())
+		return
+	}
+
+	s.logger.Debug("Request received", F("conn", c.ID), F("action", req.Action), Payload("body", msg))
+
+	// handlers run outside the poll loop so they can be cancelled,
+	// requests of a connection are served one at a time so responses keep their order
+	dispatch, err := c.enqueue(&job{handler: handler, req: req})
+	if err != nil {
+		s.countRequest(actionLabel(handler), "REJECTED")
+		s.reply(c, req, Response{Status: APIStatus.Error, Message: err.Error()})
 		return
 	}
+	atomic.AddInt64(&s.pending, 1)
+	if dispatch {
+		select {
+		case s.ready <- c:
+		case <-s.ctx.Done():
+		}
+	}
+}
+
+// dispatcher serve pending requests of one connection at a time, in arrival order
+func (s *Server) dispatcher() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case c := <-s.ready:
+			for j := c.next(); j != nil; j = c.next() {
+				atomic.AddInt64(&s.pending, -1)
+				s.serve(c, j.handler, j.req)
+			}
+		}
+	}
+}
 
-	response := handleFunc(req)
+func (s *Server) serve(c *Connection, handler *Handler, req Request) {
+	if c.Context().Err() != nil {
+		// connection closed while the request was pending
+		s.countRequest(actionLabel(handler), "CANCELLED")
+		return
+	}
 
+	traceID := req.TraceID
+	if !validTraceID(traceID) {
+		traceID = newTraceID()
+	}
+	ctx := newRequestContext(c.Context(), c, traceID)
+	if s.services != nil {
+		ctx = WithServices(ctx, s.services)
+	}
+	var cancel context.CancelFunc
+	timeout := handler.Timeout()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	ctx, span := GetTracer().Start(ctx, req.Action, SpanKindServer)
+	span.SetAttribute("conn.id", c.ID)
+	defer span.End()
+
+	start := time.Now()
+	done := make(chan Response, 1)
+	go func() {
+		done <- handler.Fn(ctx, req)
+	}()
+
+	var response Response
+	select {
+	case response = <-done:
+	case <-ctx.Done():
+		// reply without waiting but don't abandon the handler: it holds the dispatcher
+		// until it returns, so the next request of the connection can't overlap it
+		defer func() { <-done }()
+		if c.Context().Err() != nil {
+			// connection closed or server stopped, nobody to reply to
+			s.countRequest(actionLabel(handler), "CANCELLED")
+			span.SetStatus(SpanStatusError, "cancelled")
+			return
+		}
+		response = Response{
+			Status:  APIStatus.Error,
+			Message: "Action " + req.Action + " timed out after " + timeout.String(),
+		}
+	}
+
+	// label by registered action so wildcard & not-found don't blow up cardinality
+	s.metrics.latency.With(actionLabel(handler)).ObserveSince(start)
+	s.countRequest(actionLabel(handler), response.Status)
+	span.SetAttribute("response.status", response.Status)
+	if response.Status != APIStatus.Ok {
+		span.SetStatus(SpanStatusError, response.Message)
+	}
+
+	s.reply(c, req, response)
+}
+
+func (s *Server) reply(c *Connection, req Request, response Response) {
 	jsn, err := util.ToJson(response)
 	if err != nil {
 		panic(err)
 	}
 
-	wsutil.WriteServerText(conn, jsn)
+	if err = s.write(c, jsn); err != nil {
+		s.logger.Warn("Failed to write response", F("conn", c.ID), F("action", req.Action), F("error", err))
+	}
 }
 
-func (s *Server) SetHandle(path string, handler HandleFunc) {
-	s.handlers[path] = handler
+func (s *Server) write(c *Connection, data []byte) error {
+	s.metrics.framesOut.With().Inc()
+	s.metrics.bytesOut.With().Add(float64(len(data)))
+	return c.WriteText(data)
+}
+
+// notFoundLabel action label of requests matching no registered action
+const notFoundLabel = "not_found"
+
+// actionLabel action label of requests served by handler
+func actionLabel(handler *Handler) string {
+	if handler.Action == "" {
+		// the not-found handler
+		return notFoundLabel
+	}
+	return handler.Action
+}
+
+func (s *Server) countRequest(action string, status string) {
+	s.metrics.requests.With(action, status).Inc()
+}
+
+// SetHandle register handler for an action, see Router.SetHandle
+func (s *Server) SetHandle(path string, handler HandleFunc) *Handler {
+	return s.Router.SetHandle(path, handler)
+}
+
+// Group create namespace of actions, see Router.Group
+func (s *Server) Group(name string) *Group {
+	return s.Router.Group(name)
+}
+
+// SetNotFound handler used when no action matched
+func (s *Server) SetNotFound(handler HandleFunc) *Handler {
+	return s.Router.SetNotFound(handler)
+}
+
+// Actions list registered actions
+func (s *Server) Actions() []HandlerInfo {
+	return s.Router.Actions()
 }
 
 func (s *Server) GetHandler(path string) HandleFunc {
-	return s.handlers[path]
+	h := s.Router.Match(path)
+	if h == nil {
+		return nil
+	}
+	return h.Fn
 }
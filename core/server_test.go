@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+)
+
+// wsClient open a connection to s, frames written by the server are received on replies
+func wsClient(t *testing.T, s *Server) (conn net.Conn, client net.Conn, replies chan string) {
+	conn, client = net.Pipe()
+	if _, err := s.AddConn(conn); err != nil {
+		t.Fatal(err)
+	}
+	replies = make(chan string, 64)
+	go func() {
+		defer close(replies)
+		for {
+			b, err := wsutil.ReadServerText(client)
+			if err != nil {
+				return
+			}
+			replies <- string(b)
+		}
+	}()
+	t.Cleanup(func() { client.Close() })
+	return conn, client, replies
+}
+
+// send write a frame from the client & process it as the poll loop does
+func send(s *Server, conn net.Conn, client net.Conn, msg string) {
+	go wsutil.WriteClientText(client, []byte(msg))
+	s.Process(conn)
+}
+
+func receive(t *testing.T, replies chan string) string {
+	select {
+	case r := <-replies:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no reply")
+	}
+	return ""
+}
+
+func TestServerNotFoundLabel(t *testing.T) {
+	s := NewServer(-10)
+	defer s.Stop()
+	go s.dispatcher()
+	conn, client, replies := wsClient(t, s)
+
+	send(s, conn, client, `{"Action":"missing"}`)
+	if r := receive(t, replies); !strings.HasPrefix(r, "NO HANDLER") {
+		t.Fatalf("reply = %s, want NO HANDLER", r)
+	}
+	if v := s.metrics.requests.With(notFoundLabel, "NO_HANDLER").Value(); v != 1 {
+		t.Fatalf("requests of no handler = %v, want 1", v)
+	}
+
+	s.SetNotFound(func(ctx context.Context, request Request) Response {
+		return Response{Status: APIStatus.NotFound, Message: "Unknown " + request.Action + "."}
+	})
+	send(s, conn, client, `{"Action":"missing"}`)
+	if r := receive(t, replies); !strings.Contains(r, "Unknown missing.") {
+		t.Fatalf("reply = %s, want the not-found handler response", r)
+	}
+	if v := s.metrics.requests.With(notFoundLabel, APIStatus.NotFound).Value(); v != 1 {
+		t.Fatalf("requests of the not-found handler = %v, want 1", v)
+	}
+
+	var out strings.Builder
+	s.Metrics.WritePrometheus(&out)
+	if strings.Contains(out.String(), `action=""`) {
+		t.Fatalf("empty action label exposed:\n%s", out.String())
+	}
+}
+
+func TestServerResponseOrder(t *testing.T) {
+	s := NewServer(-10)
+	defer s.Stop()
+	for i := 0; i < 8; i++ {
+		go s.dispatcher()
+	}
+	var running int32
+	s.SetHandle("echo", func(ctx context.Context, request Request) Response {
+		if atomic.AddInt32(&running, 1) != 1 {
+			t.Error("requests of one connection served concurrently")
+		}
+		defer atomic.AddInt32(&running, -1)
+		// earlier requests are slower
+		n, _ := strconv.Atoi(request.TraceID)
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+		return Response{Status: APIStatus.Ok, Message: request.TraceID}
+	})
+	conn, client, replies := wsClient(t, s)
+
+	for i := 0; i < 10; i++ {
+		send(s, conn, client, `{"Action":"echo","TraceID":"`+strconv.Itoa(i)+`"}`)
+	}
+	for i := 0; i < 10; i++ {
+		if r := receive(t, replies); !strings.Contains(r, `"Message":"`+strconv.Itoa(i)+`"`) {
+			t.Fatalf("reply %d = %s, want the response of request %d", i, r, i)
+		}
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	s := NewServer(-10)
+	defer s.Stop()
+	go s.dispatcher()
+	go s.dispatcher()
+	returned := make(chan error, 1)
+	s.SetHandle("slow", func(ctx context.Context, request Request) Response {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		returned <- ctx.Err()
+		return Response{Status: APIStatus.Ok}
+	}).SetTimeout(20 * time.Millisecond)
+	s.SetHandle("fast", func(ctx context.Context, request Request) Response {
+		select {
+		case <-returned:
+		default:
+			t.Error("next request served before the timed out handler returned")
+		}
+		return Response{Status: APIStatus.Ok, Message: "fast"}
+	})
+	conn, client, replies := wsClient(t, s)
+
+	send(s, conn, client, `{"Action":"slow"}`)
+	send(s, conn, client, `{"Action":"fast"}`)
+	if r := receive(t, replies); !strings.Contains(r, "timed out") {
+		t.Fatalf("reply = %s, want timed out", r)
+	}
+	if r := receive(t, replies); !strings.Contains(r, `"Message":"fast"`) {
+		t.Fatalf("reply = %s, want the next response", r)
+	}
+}
+
+func TestServerCancelOnDisconnect(t *testing.T) {
+	s := NewServer(-10)
+	defer s.Stop()
+	go s.dispatcher()
+	started := make(chan string, 1)
+	canceled := make(chan error, 1)
+	s.SetHandle("wait", func(ctx context.Context, request Request) Response {
+		started <- ConnIDFromContext(ctx)
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return Response{Status: APIStatus.Ok}
+	})
+	conn, client, _ := wsClient(t, s)
+
+	send(s, conn, client, `{"Action":"wait"}`)
+	var id string
+	select {
+	case id = <-started:
+	case <-time.After(time.Second):
+		t.Fatal("handler not started")
+	}
+	if err := s.Disconnect(id); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-canceled:
+		if err != context.Canceled {
+			t.Fatalf("handler ctx error = %v, want cancelled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx not done after disconnect")
+	}
+	if !waitFor(time.Second, func() bool { return s.metrics.requests.With("wait", "CANCELLED").Value() == 1 }) {
+		t.Fatal("cancelled request not counted")
+	}
+}
+
+func TestServerTooManyPending(t *testing.T) {
+	// no dispatcher, requests stay pending
+	s := NewServer(-10)
+	defer s.Stop()
+	s.SetHandle("echo", func(ctx context.Context, request Request) Response {
+		return Response{Status: APIStatus.Ok}
+	})
+	conn, client, replies := wsClient(t, s)
+
+	for i := 0; i < maxPendingRequests; i++ {
+		send(s, conn, client, `{"Action":"echo"}`)
+	}
+	select {
+	case r := <-replies:
+		t.Fatalf("reply = %s before the queue is full", r)
+	default:
+	}
+	send(s, conn, client, `{"Action":"echo"}`)
+	if r := receive(t, replies); !strings.Contains(r, "Too many pending requests.") {
+		t.Fatalf("reply = %s, want rejected", r)
+	}
+	if v := s.metrics.requests.With("echo", "REJECTED").Value(); v != 1 {
+		t.Fatalf("rejected requests = %v, want 1", v)
+	}
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Services registry of dependencies handed to handlers through their context.
+// Handlers get them with Service instead of package globals, asking for the small interface
+// they use rather than a concrete type. Tests build their own registry with fakes added by Set
+// and call the handler with WithServices(ctx, services).
+type Services struct {
+	models  map[string]*DBModel
+	clients map[string]*RestClient
+	caches  map[string]*LCache
+	queues  map[string]*DBQueue2
+	values  map[string]interface{}
+	lock    *sync.RWMutex
+}
+
+// NewServices ...
+func NewServices() *Services {
+	return &Services{
+		models:  map[string]*DBModel{},
+		clients: map[string]*RestClient{},
+		caches:  map[string]*LCache{},
+		queues:  map[string]*DBQueue2{},
+		values:  map[string]interface{}{},
+		lock:    &sync.RWMutex{},
+	}
+}
+
+// AddModel ...
+func (s *Services) AddModel(name string, model *DBModel) *Services {
+	s.lock.Lock()
+	s.models[name] = model
+	s.lock.Unlock()
+	return s
+}
+
+// Model nil if not registered
+func (s *Services) Model(name string) *DBModel {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.models[name]
+}
+
+// AddRestClient ...
+func (s *Services) AddRestClient(name string, client *RestClient) *Services {
+	s.lock.Lock()
+	s.clients[name] = client
+	s.lock.Unlock()
+	return s
+}
+
+// RestClient nil if not registered
+func (s *Services) RestClient(name string) *RestClient {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.clients[name]
+}
+
+// AddCache ...
+func (s *Services) AddCache(name string, cache *LCache) *Services {
+	s.lock.Lock()
+	s.caches[name] = cache
+	s.lock.Unlock()
+	return s
+}
+
+// Cache nil if not registered
+func (s *Services) Cache(name string) *LCache {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.caches[name]
+}
+
+// AddQueue ...
+func (s *Services) AddQueue(name string, queue *DBQueue2) *Services {
+	s.lock.Lock()
+	s.queues[name] = queue
+	s.lock.Unlock()
+	return s
+}
+
+// Queue nil if not registered
+func (s *Services) Queue(name string) *DBQueue2 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.queues[name]
+}
+
+// Set register any other dependency, or a fake of one in tests, see Service
+func (s *Services) Set(name string, value interface{}) *Services {
+	s.lock.Lock()
+	s.values[name] = value
+	s.lock.Unlock()
+	return s
+}
+
+// Get dependency registered by Set, nil if not registered
+func (s *Services) Get(name string) interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.values[name]
+}
+
+// lookup everything registered under name, values added by Set first
+func (s *Services) lookup(name string) []interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var found []interface{}
+	if v, ok := s.values[name]; ok {
+		found = append(found, v)
+	}
+	if v, ok := s.models[name]; ok {
+		found = append(found, v)
+	}
+	if v, ok := s.clients[name]; ok {
+		found = append(found, v)
+	}
+	if v, ok := s.caches[name]; ok {
+		found = append(found, v)
+	}
+	if v, ok := s.queues[name]; ok {
+		found = append(found, v)
+	}
+	return found
+}
+
+// CacheNames registered cache names, sorted
+func (s *Services) CacheNames() []string {
+	s.lock.RLock()
+	names := make([]string, 0, len(s.caches))
+	for name := range s.caches {
+		names = append(names, name)
+	}
+	s.lock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// WithServices return ctx carrying services
+func WithServices(ctx context.Context, services *Services) context.Context {
+	return context.WithValue(ctx, servicesKey, services)
+}
+
+// ServicesFromContext return services of the app handling the request, an empty registry if none
+func ServicesFromContext(ctx context.Context) *Services {
+	if s, ok := ctx.Value(servicesKey).(*Services); ok && s != nil {
+		return s
+	}
+	return NewServices()
+}
+
+// Service dependency registered under name in services of ctx which implements T,
+// false if there is none. T is usually an interface declared by the handler, so the
+// *DBModel registered by AddModel in the app and a fake registered by Set in tests both fit:
+//
+//	type orderStore interface {
+//		QueryOne(query interface{}) *DbResponse
+//	}
+//
+//	orders, ok := core.Service[orderStore](ctx, "order")
+func Service[T any](ctx context.Context, name string) (T, bool) {
+	for _, v := range ServicesFromContext(ctx).lookup(name) {
+		if t, ok := v.(T); ok {
+			return t, true
+		}
+	}
+	var zero T
+	return zero, false
+}
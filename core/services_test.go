@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+type orderStore interface {
+	QueryOne(query interface{}) *DbResponse
+}
+
+type fakeOrderStore struct {
+	queries []interface{}
+}
+
+func (f *fakeOrderStore) QueryOne(query interface{}) *DbResponse {
+	f.queries = append(f.queries, query)
+	return &DbResponse{Status: DbStatus.Ok, Message: "Found.", Data: "order-1"}
+}
+
+func handleGetOrder(ctx context.Context, request Request) Response {
+	orders, ok := Service[orderStore](ctx, "order")
+	if !ok {
+		return Response{Status: APIStatus.Error, Message: "No order store."}
+	}
+	resp := orders.QueryOne(request.Data)
+	return Response{Status: resp.Status, Message: resp.Message, Data: resp.Data}
+}
+
+func TestServiceFake(t *testing.T) {
+	fake := &fakeOrderStore{}
+	ctx := WithServices(context.Background(), NewServices().Set("order", fake))
+
+	resp := handleGetOrder(ctx, Request{Action: "order.get", Data: "1"})
+	if resp.Status != APIStatus.Ok || resp.Data != "order-1" {
+		t.Fatalf("handler = %+v, want the order of the fake", resp)
+	}
+	if len(fake.queries) != 1 || fake.queries[0] != "1" {
+		t.Fatalf("fake queried with %v, want [1]", fake.queries)
+	}
+
+	if resp := handleGetOrder(context.Background(), Request{}); resp.Status != APIStatus.Error {
+		t.Fatalf("handler without services = %s, want %s", resp.Status, APIStatus.Error)
+	}
+}
+
+func TestServiceTypedSlots(t *testing.T) {
+	model := &DBModel{ColName: "order"}
+	cache := NewLCache(10, 60)
+	defer cache.Close()
+	ctx := WithServices(context.Background(), NewServices().AddModel("order", model).AddCache("order", cache))
+
+	// same name in several slots, the one implementing T is returned
+	if got, ok := Service[orderStore](ctx, "order"); !ok || got != orderStore(model) {
+		t.Fatalf("Service[orderStore]() = %v, %v, want the registered model", got, ok)
+	}
+	if got, ok := Service[*LCache](ctx, "order"); !ok || got != cache {
+		t.Fatalf("Service[*LCache]() = %v, %v, want the registered cache", got, ok)
+	}
+	if _, ok := Service[*RestClient](ctx, "order"); ok {
+		t.Fatal("Service[*RestClient]() found a client that was not registered")
+	}
+	if _, ok := Service[orderStore](ctx, "missing"); ok {
+		t.Fatal("Service() found an unregistered name")
+	}
+}
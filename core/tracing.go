@@ -0,0 +1,525 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binhgo/foosee/util"
+)
+
+// SpanKind follow OpenTelemetry span kinds
+type SpanKind int
+
+// Span kinds
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// SpanStatus follow OpenTelemetry status codes
+type SpanStatus int
+
+// Span status
+const (
+	SpanStatusUnset SpanStatus = 0
+	SpanStatusOk    SpanStatus = 1
+	SpanStatusError SpanStatus = 2
+)
+
+// Span one timed operation of a trace
+type Span struct {
+	TraceID       string                 `json:"traceId"`
+	SpanID        string                 `json:"spanId"`
+	ParentSpanID  string                 `json:"parentSpanId,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          SpanKind               `json:"kind"`
+	StartTime     time.Time              `json:"startTime"`
+	EndTime       time.Time              `json:"endTime"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Status        SpanStatus             `json:"status"`
+	StatusMessage string                 `json:"statusMessage,omitempty"`
+
+	tracer *Tracer
+	lock   *sync.Mutex
+	ended  bool
+}
+
+// SetAttribute ...
+func (s *Span) SetAttribute(key string, value interface{}) *Span {
+	s.lock.Lock()
+	if s.Attributes == nil {
+		s.Attributes = map[string]interface{}{}
+	}
+	s.Attributes[key] = value
+	s.lock.Unlock()
+	return s
+}
+
+// SetStatus ...
+func (s *Span) SetStatus(status SpanStatus, message string) *Span {
+	s.lock.Lock()
+	s.Status = status
+	s.StatusMessage = message
+	s.lock.Unlock()
+	return s
+}
+
+// RecordError mark span as error, nil error is ignored
+func (s *Span) RecordError(err error) *Span {
+	if err != nil {
+		s.SetStatus(SpanStatusError, err.Error())
+	}
+	return s
+}
+
+// End finish the span and hand it to the exporter, calling End twice has no effect
+func (s *Span) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.lock.Unlock()
+
+	if s.tracer != nil && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpans([]*Span{s})
+	}
+}
+
+// Traceparent W3C trace context header value
+func (s *Span) Traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+// SpanExporter receive ended spans
+type SpanExporter interface {
+	ExportSpans(spans []*Span) error
+	Shutdown() error
+}
+
+// Tracer create spans & export them
+type Tracer struct {
+	ServiceName string
+	exporter    SpanExporter
+}
+
+// NewTracer exporter = nil means spans are created for propagation but not exported
+func NewTracer(serviceName string, exporter SpanExporter) *Tracer {
+	return &Tracer{ServiceName: serviceName, exporter: exporter}
+}
+
+var globalTracer = NewTracer("", nil)
+var tracerLock = &sync.RWMutex{}
+
+// SetTracer set tracer used by Server, RestClient & DBModel
+func SetTracer(t *Tracer) {
+	tracerLock.Lock()
+	globalTracer = t
+	tracerLock.Unlock()
+}
+
+// GetTracer ...
+func GetTracer() *Tracer {
+	tracerLock.RLock()
+	defer tracerLock.RUnlock()
+	return globalTracer
+}
+
+type spanKey struct{}
+
+// SpanFromContext return current span, nil if none
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start create a child of the span in ctx, or a root span which reuse trace id of ctx if any
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		SpanID:    newSpanID(),
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+		tracer:    t,
+		lock:      &sync.Mutex{},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else if id := TraceIDFromContext(ctx); validTraceID(id) {
+		span.TraceID = id
+	} else {
+		span.TraceID = newTraceID()
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Shutdown flush & stop the exporter
+func (t *Tracer) Shutdown() error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown()
+}
+
+func newSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validTraceID(id string) bool {
+	if len(id) != 32 || id == strings.Repeat("0", 32) {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// MemoryExporter keep spans in memory, for local testing
+type MemoryExporter struct {
+	spans []*Span
+	lock  *sync.Mutex
+}
+
+// NewMemoryExporter ...
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{lock: &sync.Mutex{}}
+}
+
+// ExportSpans ...
+func (e *MemoryExporter) ExportSpans(spans []*Span) error {
+	e.lock.Lock()
+	e.spans = append(e.spans, spans...)
+	e.lock.Unlock()
+	return nil
+}
+
+// Spans return exported spans
+func (e *MemoryExporter) Spans() []*Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	out := make([]*Span, len(e.spans))
+	copy(out, e.spans)
+	return out
+}
+
+// Reset ...
+func (e *MemoryExporter) Reset() {
+	e.lock.Lock()
+	e.spans = nil
+	e.lock.Unlock()
+}
+
+// Shutdown ...
+func (e *MemoryExporter) Shutdown() error {
+	return nil
+}
+
+// FileExporter write one json span per line
+type FileExporter struct {
+	out  io.Writer
+	lock *sync.Mutex
+}
+
+// NewFileExporter append spans to file at path
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterExporter(f), nil
+}
+
+// NewWriterExporter write spans to out
+func NewWriterExporter(out io.Writer) *FileExporter {
+	return &FileExporter{out: out, lock: &sync.Mutex{}}
+}
+
+// ExportSpans ...
+func (e *FileExporter) ExportSpans(spans []*Span) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, s := range spans {
+		b, err := util.ToJson(s)
+		if err != nil {
+			return err
+		}
+		if _, err = e.out.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown close the file if any
+func (e *FileExporter) Shutdown() error {
+	if c, ok := e.out.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// OTLPExporter send spans in batch to an OTLP/HTTP collector (json encoding)
+type OTLPExporter struct {
+	Endpoint string
+	Headers  map[string]string
+
+	service    string
+	httpClient *http.Client
+	queue      chan *Span
+	batchSize  int
+	interval   time.Duration
+	done       chan struct{}
+	stop       sync.Once
+	wg         *sync.WaitGroup
+	logger     Logger
+}
+
+// NewOTLPExporter endpoint e.g http://otel-collector:4318/v1/traces
+func NewOTLPExporter(endpoint string, serviceName string, headers map[string]string) *OTLPExporter {
+	e := &OTLPExporter{
+		Endpoint:   endpoint,
+		Headers:    headers,
+		service:    serviceName,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		queue:      make(chan *Span, 4096),
+		batchSize:  256,
+		interval:   5 * time.Second,
+		done:       make(chan struct{}),
+		wg:         &sync.WaitGroup{},
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// SetLogger logger of failed exports, default DefaultLogger
+func (e *OTLPExporter) SetLogger(logger Logger) *OTLPExporter {
+	e.logger = logger
+	return e
+}
+
+func (e *OTLPExporter) log() Logger {
+	if e.logger == nil {
+		return DefaultLogger
+	}
+	return e.logger
+}
+
+// ExportSpans queue spans, spans are dropped when the queue is full
+func (e *OTLPExporter) ExportSpans(spans []*Span) error {
+	for _, s := range spans {
+		select {
+		case e.queue <- s:
+		default:
+			return &Error{Type: "QUEUE_FULL", Message: "OTLP exporter queue is full, span dropped."}
+		}
+	}
+	return nil
+}
+
+// Shutdown flush queued spans, calling it again only waits for the flush
+func (e *OTLPExporter) Shutdown() error {
+	e.stop.Do(func() { close(e.done) })
+	e.wg.Wait()
+	return nil
+}
+
+func (e *OTLPExporter) run() {
+	defer e.wg.Done()
+	tick := time.NewTicker(e.interval)
+	defer tick.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= e.batchSize {
+				e.flush(batch)
+				batch = batch[:0]
+			}
+		case <-tick.C:
+			if len(batch) > 0 {
+				e.flush(batch)
+				batch = batch[:0]
+			}
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+				default:
+					if len(batch) > 0 {
+						e.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush send batch, a failed batch is logged & dropped
+func (e *OTLPExporter) flush(batch []*Span) {
+	if err := e.send(batch); err != nil {
+		e.log().Warn("Export spans failed", F("endpoint", e.Endpoint), F("spans", len(batch)), F("error", err.Error()))
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := util.ToJson(otlpPayload(e.service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &Error{Type: "EXPORT_FAILED", Message: "OTLP collector respond " + resp.Status}
+	}
+	return nil
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+// otlpTraces body of OTLP/HTTP json export request
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlpAttributes ordered by key
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, k := range keys {
+		var val otlpAnyValue
+		switch t := attrs[k].(type) {
+		case bool:
+			val.BoolValue = &t
+		case int:
+			val.IntValue = strconv.Itoa(t)
+		case int64:
+			val.IntValue = strconv.FormatInt(t, 10)
+		case float64:
+			val.DoubleValue = &t
+		case string:
+			val.StringValue = &t
+		default:
+			b, _ := util.ToJson(t)
+			str := string(b)
+			val.StringValue = &str
+		}
+		out = append(out, otlpKeyValue{Key: k, Value: val})
+	}
+	return out
+}
+
+func otlpPayload(service string, spans []*Span) *otlpTraces {
+	list := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.lock.Lock()
+		list = append(list, otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: int(s.Status), Message: s.StatusMessage},
+		})
+		s.lock.Unlock()
+	}
+
+	return &otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": service})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/binhgo/foosee/core"},
+			Spans: list,
+		}},
+	}}}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTracerStart(t *testing.T) {
+	tracer := NewTracer("test", nil)
+
+	ctx, root := tracer.Start(context.Background(), "root", SpanKindServer)
+	if !validTraceID(root.TraceID) || root.ParentSpanID != "" || len(root.SpanID) != 16 {
+		t.Fatalf("root span = %+v, want new trace without parent", root)
+	}
+	if SpanFromContext(ctx) != root {
+		t.Fatal("SpanFromContext() is not the started span")
+	}
+
+	_, child := tracer.Start(ctx, "child", SpanKindClient)
+	if child.TraceID != root.TraceID || child.ParentSpanID != root.SpanID || child.SpanID == root.SpanID {
+		t.Fatalf("child span = %+v, want child of %s in trace %s", child, root.SpanID, root.TraceID)
+	}
+
+	// root span reuse the trace id of the request
+	traceID := strings.Repeat("ab", 16)
+	_, span := tracer.Start(context.WithValue(context.Background(), traceIDKey, traceID), "request", SpanKindServer)
+	if span.TraceID != traceID || span.ParentSpanID != "" {
+		t.Fatalf("span = %+v, want root span of trace %s", span, traceID)
+	}
+	_, span = tracer.Start(context.WithValue(context.Background(), traceIDKey, "not-a-trace-id"), "request", SpanKindServer)
+	if !validTraceID(span.TraceID) || span.TraceID == "not-a-trace-id" {
+		t.Fatalf("span of invalid request trace id = %+v, want a new trace", span)
+	}
+}
+
+func TestValidTraceID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{strings.Repeat("0a", 16), true},
+		{newTraceID(), true},
+		{"", false},
+		{strings.Repeat("0", 32), false},
+		{strings.Repeat("a", 31), false},
+		{strings.Repeat("a", 33), false},
+		{strings.Repeat("g", 32), false},
+	}
+	for _, tt := range tests {
+		if got := validTraceID(tt.id); got != tt.valid {
+			t.Fatalf("validTraceID(%q) = %v, want %v", tt.id, got, tt.valid)
+		}
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	_, span := NewTracer("test", nil).Start(context.Background(), "op", SpanKindClient)
+	header := span.Traceparent()
+	if !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(header) {
+		t.Fatalf("Traceparent() = %s, want W3C version 00 sampled", header)
+	}
+	parts := strings.Split(header, "-")
+	if parts[1] != span.TraceID || parts[2] != span.SpanID {
+		t.Fatalf("Traceparent() = %s, want trace %s & span %s", header, span.TraceID, span.SpanID)
+	}
+}
+
+func TestSpanEnd(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer("test", exporter)
+	_, span := tracer.Start(context.Background(), "op", SpanKindInternal)
+	span.SetAttribute("k", "v").RecordError(nil)
+	if span.Status != SpanStatusUnset {
+		t.Fatalf("Status = %d after nil error, want unset", span.Status)
+	}
+	span.RecordError(&Error{Type: "FAILED", Message: "Failed."})
+	span.End()
+	span.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1 after End twice", len(spans))
+	}
+	s := spans[0]
+	if s.EndTime.Before(s.StartTime) || s.Status != SpanStatusError || s.Attributes["k"] != "v" {
+		t.Fatalf("exported span = %+v", s)
+	}
+	exporter.Reset()
+	if len(exporter.Spans()) != 0 {
+		t.Fatal("Reset() kept spans")
+	}
+}
+
+// otlpCollector test collector recording export requests
+type otlpCollector struct {
+	server  *httptest.Server
+	status  int
+	bodies  []otlpTraces
+	headers []http.Header
+	lock    sync.Mutex
+}
+
+func newOTLPCollector(t *testing.T, status int) *otlpCollector {
+	c := &otlpCollector{status: status}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var body otlpTraces
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("invalid export body %s: %v", b, err)
+		}
+		c.lock.Lock()
+		c.bodies = append(c.bodies, body)
+		c.headers = append(c.headers, r.Header)
+		c.lock.Unlock()
+		w.WriteHeader(c.status)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func TestOTLPExporter(t *testing.T) {
+	collector := newOTLPCollector(t, http.StatusOK)
+	exporter := NewOTLPExporter(collector.server.URL, "svc", map[string]string{"Authorization": "Bearer token"})
+	tracer := NewTracer("svc", exporter)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindClient)
+	child.SetAttribute("s", "v").SetAttribute("i", 3).SetAttribute("b", true).SetAttribute("f", 1.5)
+	child.SetStatus(SpanStatusError, "failed")
+	child.End()
+	parent.End()
+
+	// shutdown flushes the queue, a second call is harmless
+	exporter.Shutdown()
+	exporter.Shutdown()
+
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	if len(collector.bodies) != 1 {
+		t.Fatalf("collector received %d requests, want 1 batch", len(collector.bodies))
+	}
+	if h := collector.headers[0]; h.Get("Authorization") != "Bearer token" || h.Get("Content-Type") != "application/json" {
+		t.Fatalf("request headers = %v", h)
+	}
+	rs := collector.bodies[0].ResourceSpans
+	if len(rs) != 1 || len(rs[0].ScopeSpans) != 1 {
+		t.Fatalf("body = %+v, want one resource & scope", collector.bodies[0])
+	}
+	if attrs := rs[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" || *attrs[0].Value.StringValue != "svc" {
+		t.Fatalf("resource attributes = %+v, want service.name svc", attrs)
+	}
+	spans := rs[0].ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("spans = %+v, want child then parent", spans)
+	}
+	s := spans[0]
+	if s.TraceID != parent.TraceID || s.ParentSpanID != parent.SpanID || s.Kind != int(SpanKindClient) {
+		t.Fatalf("child = %+v, want child of the parent span", s)
+	}
+	if s.Status.Code != int(SpanStatusError) || s.Status.Message != "failed" {
+		t.Fatalf("child status = %+v, want error failed", s.Status)
+	}
+	if s.StartTimeUnixNano == "" || s.EndTimeUnixNano < s.StartTimeUnixNano {
+		t.Fatalf("child times = %s - %s", s.StartTimeUnixNano, s.EndTimeUnixNano)
+	}
+
+	// attributes sorted by key, typed as OTLP AnyValue
+	a := s.Attributes
+	if len(a) != 4 || a[0].Key != "b" || a[1].Key != "f" || a[2].Key != "i" || a[3].Key != "s" {
+		t.Fatalf("attributes = %+v, want b f i s", a)
+	}
+	if *a[0].Value.BoolValue != true || *a[1].Value.DoubleValue != 1.5 || a[2].Value.IntValue != "3" || *a[3].Value.StringValue != "v" {
+		t.Fatalf("attribute values = %+v", a)
+	}
+}
+
+func TestOTLPExporterFailure(t *testing.T) {
+	collector := newOTLPCollector(t, http.StatusInternalServerError)
+	var logs logBuffer
+	exporter := NewOTLPExporter(collector.server.URL, "svc", nil).SetLogger(NewLogger(&logs, LoggerConfig{Level: LevelInfo}))
+	_, span := NewTracer("svc", exporter).Start(context.Background(), "op", SpanKindInternal)
+	span.End()
+	exporter.Shutdown()
+
+	if out := logs.String(); !strings.Contains(out, "Export spans failed") || !strings.Contains(out, "500") {
+		t.Fatalf("failed export not logged: %s", out)
+	}
+}
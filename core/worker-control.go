@@ -0,0 +1,132 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/binhgo/foosee/util"
+)
+
+// Worker find worker by name, nil if not found
+func (app *App) Worker(name string) *Worker {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	for _, w := range app.WorkerList {
+		if w.Name == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// Workers status of all workers in WorkerList
+func (app *App) Workers() []WorkerStatus {
+	app.lock.Lock()
+	workers := make([]*Worker, len(app.WorkerList))
+	copy(workers, app.WorkerList)
+	app.lock.Unlock()
+
+	list := make([]WorkerStatus, 0, len(workers))
+	for _, w := range workers {
+		list = append(list, w.Status())
+	}
+	return list
+}
+
+// WorkerHandler control workers at runtime:
+//
+//	GET  /workers                           list workers with schedule & state
+//	GET  /workers/{name}                    one worker, with run history
+//	POST /workers/{name}/pause
+//	POST /workers/{name}/resume
+//	POST /workers/{name}/trigger            run now
+//	POST /workers/{name}/period?seconds=60  change repeat period
+//
+// Every request requires header "Authorization: Bearer <secret>" like AdminHandler,
+// which also serves these routes under /admin.
+func (app *App) WorkerHandler(secret string) http.Handler {
+	return app.requireSecret(secret, app.workerHandler())
+}
+
+// workerHandler routes of WorkerHandler without authentication
+func (app *App) workerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+		if len(parts) == 0 || parts[0] != "workers" || len(parts) > 3 {
+			writeResponse(w, http.StatusNotFound, &Response{Status: APIStatus.NotFound, Message: "Not found " + r.URL.Path + "."})
+			return
+		}
+
+		if len(parts) == 1 {
+			writeResponse(w, http.StatusOK, &Response{Status: APIStatus.Ok, Message: "Query workers successfully.", Data: app.Workers()})
+			return
+		}
+
+		worker := app.Worker(parts[1])
+		if worker == nil {
+			writeResponse(w, http.StatusNotFound, &Response{Status: APIStatus.NotFound, Message: "Not found worker " + parts[1] + "."})
+			return
+		}
+
+		if len(parts) == 2 {
+			writeResponse(w, http.StatusOK, &Response{
+				Status:  APIStatus.Ok,
+				Message: "Query worker successfully.",
+				Data: map[string]interface{}{
+					"status":  worker.Status(),
+					"history": worker.History(),
+				},
+			})
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			writeResponse(w, http.StatusMethodNotAllowed, &Response{Status: APIStatus.Invalid, Message: "Require POST method."})
+			return
+		}
+		status, resp := app.controlWorker(worker, parts[2], r.URL.Query().Get("seconds"), r.RemoteAddr)
+		writeResponse(w, status, resp)
+	})
+}
+
+// controlWorker run command on worker, by identifies the caller in logs
+func (app *App) controlWorker(worker *Worker, command string, seconds string, by string) (int, *Response) {
+	switch command {
+	case "pause":
+		worker.Pause()
+	case "resume":
+		worker.Resume()
+	case "trigger":
+		err := worker.TriggerNow()
+		if err != nil {
+			return http.StatusConflict, &Response{Status: APIStatus.Error, Message: err.Error()}
+		}
+	case "period":
+		period, err := strconv.Atoi(seconds)
+		if err != nil || period <= 0 {
+			return http.StatusBadRequest, &Response{Status: APIStatus.Invalid, Message: "Require positive seconds."}
+		}
+		if worker.Status().Cron != "" {
+			return http.StatusConflict, &Response{Status: APIStatus.Error, Message: "Worker " + worker.Name + " runs on cron schedule."}
+		}
+		if !worker.scheduled() {
+			// stopped or one-shot schedule finished, the period would not be used
+			return http.StatusConflict, &Response{Status: APIStatus.Error, Message: "Worker " + worker.Name + " has no scheduled run."}
+		}
+		worker.SetRepeatPeriod(period)
+	default:
+		return http.StatusNotFound, &Response{Status: APIStatus.NotFound, Message: "Unknown command " + command + "."}
+	}
+
+	app.logger.Info("Worker control", F("worker", worker.Name), F("command", command), F("by", by))
+	return http.StatusOK, &Response{Status: APIStatus.Ok, Message: "Worker " + worker.Name + " " + command + " successfully.", Data: worker.Status()}
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp *Response) {
+	body, _ := util.ToJson(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestControlWorkerPeriod(t *testing.T) {
+	app := NewApp("test")
+	repeating := startWorker(t, (&Worker{}).SetTask(func() {}).SetRepeatPeriod(10))
+	if status, resp := app.controlWorker(repeating, "period", "60", "test"); status != http.StatusOK {
+		t.Fatalf("period of a scheduled worker = %d %s", status, resp.Message)
+	}
+	if p := repeating.Status().Period; p != 60 {
+		t.Fatalf("Period = %d, want 60", p)
+	}
+	if status, _ := app.controlWorker(repeating, "period", "-1", "test"); status != http.StatusBadRequest {
+		t.Fatalf("negative period = %d, want 400", status)
+	}
+
+	oneShot := (&Worker{Name: "once"}).SetTask(func() {})
+	if err := oneShot.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer oneShot.Stop(context.Background())
+	if !waitFor(time.Second, func() bool { return len(oneShot.History()) == 1 && oneShot.NextRun().IsZero() }) {
+		t.Fatal("one-shot worker did not run")
+	}
+	status, resp := app.controlWorker(oneShot, "period", "60", "test")
+	if status != http.StatusConflict || oneShot.Status().Period != 0 {
+		t.Fatalf("period of a finished one-shot worker = %d %s, want 409 without change", status, resp.Message)
+	}
+}
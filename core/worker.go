@@ -1,20 +1,118 @@
 package core
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"sync"
 	"time"
 )
 
 // Task ...
 type Task = func()
 
+// ContextTask task receiving a context which is done when the run times out or the worker stops
+type ContextTask = func(ctx context.Context)
+
+// ErrorTask task reporting failure by returning error, failed runs are retried according to SetRetry
+type ErrorTask = func(ctx context.Context) error
+
+// WorkerHook called after each run, err is nil for successful run
+type WorkerHook = func(worker *Worker, run WorkerRun, err error)
+
+// OverlapPolicy what to do when a run is due while the previous one is still running
+type OverlapPolicy string
+
+// Overlap policies
+const (
+	// OverlapSkip drop the due run (default)
+	OverlapSkip OverlapPolicy = "SKIP"
+	// OverlapQueue run after the running one finishes, at most maxQueuedRuns are waiting
+	OverlapQueue OverlapPolicy = "QUEUE"
+	// OverlapAllow run concurrently
+	OverlapAllow OverlapPolicy = "ALLOW"
+)
+
+const (
+	maxQueuedRuns     = 16
+	workerHistorySize = 20
+	// minLeaseTTL shortest lease of singleton workers, shorter ones would renew in a busy loop
+	minLeaseTTL = time.Second
+)
+
+// Worker states reported by Status
+const (
+	WorkerStopped = "STOPPED"
+	WorkerIdle    = "IDLE"
+	WorkerRunning = "RUNNING"
+	WorkerPaused  = "PAUSED"
+	// WorkerStandby singleton worker on instance not holding the lease
+	WorkerStandby = "STANDBY"
+)
+
+// WorkerStatus schedule & state of a worker
+type WorkerStatus struct {
+	Name      string        `json:"name"`
+	State     string        `json:"state"`
+	Delay     int           `json:"delay"`
+	Period    int           `json:"period"`
+	Cron      string        `json:"cron,omitempty"`
+	Overlap   OverlapPolicy `json:"overlap"`
+	Singleton bool          `json:"singleton"`
+	NextRun   *time.Time    `json:"nextRun,omitempty"`
+	LastRun   *WorkerRun    `json:"lastRun,omitempty"`
+	Running   int           `json:"running"`
+	Skipped   int64         `json:"skipped"`
+	Failures  int64         `json:"failures"`
+}
+
+// WorkerRun result of one run of the task
+type WorkerRun struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error,omitempty"`
+}
+
 // AppWorker ...
 type Worker struct {
-	Task   Task
-	delay  int
-	period int
+	Name        string
+	Task        Task
+	contextTask ContextTask
+	errorTask   ErrorTask
+	delay       int
+	period      int
+	cron        *CronSchedule
+	cronErr     error
+	location    *time.Location
+	nextRun     time.Time
+	overlap     OverlapPolicy
+	timeout     time.Duration
+	maxRetry    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	onSuccess   []WorkerHook
+	onError     []WorkerHook
+	logger      Logger
+	lease       *DBLease
+	leaseTTL    time.Duration
+	leaderUntil time.Time
+	cancel      context.CancelFunc
+	done        chan struct{}
+	now         chan struct{}
+	reschedule  chan struct{}
+
+	// run state
+	paused   bool
+	busy     bool
+	running  int
+	skipped  int64
+	failures int64
+	history  []WorkerRun
+
+	lock sync.Mutex
 }
 
 // SetTask ..
@@ -23,37 +121,713 @@ func (worker *Worker) SetTask(fn Task) *Worker {
 	return worker
 }
 
+// SetContextTask set task that can observe run timeout & worker stop through its context
+func (worker *Worker) SetContextTask(fn ContextTask) *Worker {
+	worker.contextTask = fn
+	return worker
+}
+
+// SetErrorTask set task returning error, see SetRetry
+func (worker *Worker) SetErrorTask(fn ErrorTask) *Worker {
+	worker.errorTask = fn
+	return worker
+}
+
+// SetName name used in logs & reports
+func (worker *Worker) SetName(name string) *Worker {
+	worker.Name = name
+	return worker
+}
+
 // SetDelay ...
 func (worker *Worker) SetDelay(seconds int) *Worker {
 	worker.delay = seconds
 	return worker
 }
 
-// SetRepeatPeriod ...
+// SetRepeatPeriod can be changed while running, next run is rescheduled from the previous one
 func (worker *Worker) SetRepeatPeriod(seconds int) *Worker {
+	worker.lock.Lock()
 	worker.period = seconds
+	notify(worker.reschedule)
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetCron run task on cron schedule instead of repeat period, see ParseCron for the syntax.
+// Invalid expression is reported by Start. Changing a running worker with an invalid expression keeps the current schedule.
+func (worker *Worker) SetCron(expr string) *Worker {
+	cron, err := ParseCron(expr)
+	worker.lock.Lock()
+	started := worker.done != nil
+	if err == nil || !started {
+		worker.cron, worker.cronErr = cron, err
+	}
+	notify(worker.reschedule)
+	worker.lock.Unlock()
+	if err != nil && started {
+		worker.log().Warn("Invalid worker cron", F("worker", worker.Name), F("error", err))
+	}
+	return worker
+}
+
+// ClearCron go back to repeat period schedule
+func (worker *Worker) ClearCron() *Worker {
+	worker.lock.Lock()
+	worker.cron, worker.cronErr = nil, nil
+	notify(worker.reschedule)
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetLocation timezone used to evaluate cron schedule, unless the expression has CRON_TZ
+func (worker *Worker) SetLocation(loc *time.Location) *Worker {
+	worker.lock.Lock()
+	worker.location = loc
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetOverlap policy applied when a run is due while the previous one is still running, default OverlapSkip
+func (worker *Worker) SetOverlap(policy OverlapPolicy) *Worker {
+	worker.lock.Lock()
+	worker.overlap = policy
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetTimeout cancel the context of each run after timeout, 0 means no timeout.
+// A Task without context can not be interrupted, its run is only reported as timed out.
+func (worker *Worker) SetTimeout(timeout time.Duration) *Worker {
+	worker.lock.Lock()
+	worker.timeout = timeout
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetRetry retry a failed run up to maxRetry times within the same run.
+// Wait before retry n is backoff * 2^(n-1) capped at maxBackoff, randomized between half and full of it.
+func (worker *Worker) SetRetry(maxRetry int, backoff time.Duration, maxBackoff time.Duration) *Worker {
+	worker.lock.Lock()
+	worker.maxRetry = maxRetry
+	worker.backoff = backoff
+	worker.maxBackoff = maxBackoff
+	worker.lock.Unlock()
+	return worker
+}
+
+// OnSuccess add hook called after each successful run
+func (worker *Worker) OnSuccess(hook WorkerHook) *Worker {
+	worker.lock.Lock()
+	worker.onSuccess = append(worker.onSuccess, hook)
+	worker.lock.Unlock()
 	return worker
 }
 
-// Execute ...
+// OnError add hook called after each failed run, once all retries are exhausted
+func (worker *Worker) OnError(hook WorkerHook) *Worker {
+	worker.lock.Lock()
+	worker.onError = append(worker.onError, hook)
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetLogger logger used to report failed runs
+func (worker *Worker) SetLogger(logger Logger) *Worker {
+	worker.lock.Lock()
+	worker.logger = logger
+	worker.lock.Unlock()
+	return worker
+}
+
+// SetSingleton only run the task on the replica holding lease of the worker name.
+// The leader renews its lease every ttl/3, another replica takes over at most ttl after the leader dies.
+// ttl must be at least 1 second, Start fails otherwise.
+func (worker *Worker) SetSingleton(lease *DBLease, ttl time.Duration) *Worker {
+	worker.lock.Lock()
+	worker.lease = lease
+	worker.leaseTTL = ttl
+	worker.lock.Unlock()
+	return worker
+}
+
+// IsLeader true if the worker is not singleton or currently holds its lease
+func (worker *Worker) IsLeader() bool {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.lease == nil || time.Now().Before(worker.leaderUntil)
+}
+
+func (worker *Worker) log() Logger {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	if worker.logger == nil {
+		return DefaultLogger
+	}
+	return worker.logger
+}
+
+// NextRun time of next scheduled run, zero if not scheduled
+func (worker *Worker) NextRun() time.Time {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.nextRun
+}
+
+// scheduled true from Start until Stop or the end of a one-shot schedule
+func (worker *Worker) scheduled() bool {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.now != nil
+}
+
+func (worker *Worker) setNextRun(t time.Time) {
+	worker.lock.Lock()
+	worker.nextRun = t
+	worker.lock.Unlock()
+}
+
+// Start run task in background until Stop is called
+func (worker *Worker) Start(ctx context.Context) error {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	if worker.cronErr != nil {
+		return worker.cronErr
+	}
+	if worker.done != nil && worker.cancel == nil {
+		return &Error{Type: "STOPPING", Message: "Worker is stopping, its running tasks have not finished yet."}
+	}
+	if worker.done != nil {
+		return &Error{Type: "ALREADY_STARTED", Message: "Worker is already started."}
+	}
+	if worker.lease != nil && (worker.Name == "" || worker.leaseTTL < minLeaseTTL) {
+		return &Error{Type: "INVALID_SINGLETON", Message: "Singleton worker requires a name and a lease ttl of at least " + minLeaseTTL.String() + "."}
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	worker.cancel = cancel
+	worker.done = make(chan struct{})
+	worker.now = make(chan struct{}, 1)
+	worker.reschedule = make(chan struct{}, 1)
+	go worker.run(runCtx, worker.done)
+	return nil
+}
+
+// Stop stop scheduling, cancel context of running tasks & wait for them to finish, or until ctx is done.
+// Queued runs are dropped. The worker can be started again once its running tasks have finished.
+func (worker *Worker) Stop(ctx context.Context) error {
+	worker.lock.Lock()
+	cancel, done := worker.cancel, worker.done
+	worker.cancel, worker.now = nil, nil
+	worker.lock.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	if cancel != nil {
+		cancel()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Execute run task & block until the worker is stopped.
+// Deprecated: use App to start workers, App owns signal handling.
 func (worker *Worker) Execute() {
-	// delay
-	time.Sleep(time.Duration(worker.delay) * time.Second)
+	worker.Start(context.Background())
+
+	worker.lock.Lock()
+	done := worker.done
+	worker.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (worker *Worker) run(ctx context.Context, done chan struct{}) {
+	defer func() {
+		// Start is refused until now, so two loops never run at once
+		worker.lock.Lock()
+		if worker.cancel != nil {
+			worker.cancel()
+		}
+		worker.cancel, worker.done = nil, nil
+		worker.lock.Unlock()
+		close(done)
+	}()
+
+	runs := make(chan struct{}, maxQueuedRuns)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go worker.executor(ctx, runs, wg)
+
+	if worker.lease != nil {
+		worker.elect()
+		wg.Add(1)
+		go worker.leader(ctx, wg)
+	}
+
+	worker.schedule(ctx, runs, wg)
+
+	// let executor finish queued runs of a one-shot schedule, they are dropped if ctx is done
+	close(runs)
+	wg.Wait()
+
+	// release after running tasks finished, so the next leader does not overlap them
+	if worker.lease != nil {
+		worker.resign()
+	}
+}
+
+func (worker *Worker) schedule(ctx context.Context, runs chan struct{}, wg *sync.WaitGroup) {
+	worker.lock.Lock()
+	now, reschedule := worker.now, worker.reschedule
+	worker.lock.Unlock()
+	defer func() {
+		worker.lock.Lock()
+		worker.nextRun = time.Time{}
+		if worker.now == now {
+			worker.now = nil
+		}
+		worker.lock.Unlock()
+	}()
+
+	// no run before the delay, except triggered manually
+	notBefore := time.Now().Add(time.Duration(worker.delay) * time.Second)
+	var last time.Time
+	next := worker.nextAfter(last, notBefore)
+	for {
+		if next.IsZero() {
+			return
+		}
+		worker.setNextRun(next)
 
-	// run first time
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			last = next
+			if worker.IsPaused() {
+				worker.log().Debug("Worker run skipped, paused.", F("worker", worker.Name))
+			} else {
+				worker.trigger(ctx, runs, wg)
+			}
+		case <-now:
+			timer.Stop()
+			worker.trigger(ctx, runs, wg)
+			continue
+		case <-reschedule:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		if n := time.Now(); n.After(notBefore) {
+			notBefore = n
+		}
+		next = worker.nextAfter(last, notBefore)
+	}
+}
+
+// nextAfter next scheduled run not before notBefore, last is the previous scheduled run or zero.
+// Zero means nothing left to run.
+func (worker *Worker) nextAfter(last time.Time, notBefore time.Time) time.Time {
+	worker.lock.Lock()
+	cron := worker.cron
+	if cron != nil && worker.location != nil && !cron.explicitTZ {
+		cron = cron.In(worker.location)
+	}
+	period := time.Duration(worker.period) * time.Second
+	worker.lock.Unlock()
+
+	switch {
+	case cron != nil:
+		return cron.Next(notBefore)
+	case last.IsZero():
+		// first run of repeating & one-shot worker
+		return notBefore
+	case period <= 0:
+		return time.Time{}
+	}
+	next := last.Add(period)
+	if next.Before(notBefore) {
+		next = notBefore
+	}
+	return next
+}
+
+// Pause skip scheduled runs until Resume, running & manually triggered runs are not affected
+func (worker *Worker) Pause() {
+	worker.lock.Lock()
+	worker.paused = true
+	worker.lock.Unlock()
+}
+
+// Resume ...
+func (worker *Worker) Resume() {
+	worker.lock.Lock()
+	worker.paused = false
+	worker.lock.Unlock()
+}
+
+// IsPaused ...
+func (worker *Worker) IsPaused() bool {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.paused
+}
+
+// TriggerNow run the task as soon as possible without changing the schedule, even if paused.
+// The run still follows overlap policy, several triggers before it starts are merged.
+func (worker *Worker) TriggerNow() error {
+	if !worker.IsLeader() {
+		return &Error{Type: "NOT_LEADER", Message: "Worker " + worker.Name + " is not leader on this instance."}
+	}
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	if worker.now == nil {
+		return &Error{Type: "NOT_RUNNING", Message: "Worker " + worker.Name + " is not running."}
+	}
+	notify(worker.now)
+	return nil
+}
+
+// notify non-blocking send on signal channel of capacity 1
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// leader keep trying to acquire / renew the lease until ctx is done
+func (worker *Worker) leader(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	tick := time.NewTicker(worker.leaseTTL / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			worker.elect()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// elect acquire or renew the lease
+func (worker *Worker) elect() {
+	start := time.Now()
+	held, err := worker.lease.Acquire(worker.Name, worker.leaseTTL)
+	if err != nil {
+		worker.log().Warn("Acquire worker lease error", F("worker", worker.Name), F("error", err))
+	}
+
+	worker.lock.Lock()
+	wasLeader := start.Before(worker.leaderUntil)
+	if held {
+		// count ttl from before the call, the DB may have been slow
+		worker.leaderUntil = start.Add(worker.leaseTTL)
+	} else if err == nil {
+		worker.leaderUntil = time.Time{}
+	}
+	worker.lock.Unlock()
+
+	if held && !wasLeader {
+		worker.log().Info("Worker became leader.", F("worker", worker.Name), F("owner", worker.lease.Owner()))
+	} else if !held && err == nil && wasLeader {
+		worker.log().Warn("Worker lost leadership.", F("worker", worker.Name))
+	}
+}
+
+func (worker *Worker) resign() {
+	worker.lock.Lock()
+	worker.leaderUntil = time.Time{}
+	worker.lock.Unlock()
+
+	err := worker.lease.Release(worker.Name)
+	if err != nil {
+		worker.log().Warn("Release worker lease error", F("worker", worker.Name), F("error", err))
+	}
+}
+
+// trigger start a due run according to overlap policy
+func (worker *Worker) trigger(ctx context.Context, runs chan struct{}, wg *sync.WaitGroup) {
+	if !worker.IsLeader() {
+		worker.log().Debug("Worker run skipped, not leader.", F("worker", worker.Name))
+		return
+	}
+
+	worker.lock.Lock()
+	policy := worker.overlap
+	switch policy {
+	case OverlapAllow:
+		worker.lock.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.execute(ctx)
+		}()
+		return
+
+	case OverlapQueue:
+		worker.lock.Unlock()
+		select {
+		case runs <- struct{}{}:
+			return
+		default:
+		}
+
+	default:
+		// busy covers both the queued & the running run, so at most one is pending.
+		// runs may still hold runs queued before the policy changed, never block on it.
+		if !worker.busy {
+			select {
+			case runs <- struct{}{}:
+				worker.busy = true
+				worker.lock.Unlock()
+				return
+			default:
+			}
+		}
+		worker.lock.Unlock()
+	}
+
+	worker.lock.Lock()
+	worker.skipped++
+	worker.lock.Unlock()
+	worker.log().Warn("Worker run skipped, previous run is still running.", F("worker", worker.Name), F("overlap", string(policy)))
+}
+
+// executor run queued runs one by one
+func (worker *Worker) executor(ctx context.Context, runs chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for range runs {
+		if ctx.Err() == nil {
+			worker.execute(ctx)
+		}
+		worker.lock.Lock()
+		worker.busy = false
+		worker.lock.Unlock()
+	}
+}
+
+// execute run task with retries, recover panic & record the result.
+// Timeout covers the whole run including retries.
+func (worker *Worker) execute(ctx context.Context) {
+	worker.lock.Lock()
+	timeout := worker.timeout
+	maxRetry, backoff, maxBackoff := worker.maxRetry, worker.backoff, worker.maxBackoff
+	worker.running++
+	worker.lock.Unlock()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	rec := WorkerRun{Start: time.Now()}
+	var err error
+	for {
+		rec.Attempts++
+		err = worker.call(ctx)
+		if err == nil || rec.Attempts > maxRetry || ctx.Err() != nil {
+			break
+		}
+		worker.log().Warn("Worker run failed, retrying.", F("worker", worker.Name), F("attempt", rec.Attempts), F("error", err))
+		if !sleepCtx(ctx, retryDelay(rec.Attempts, backoff, maxBackoff)) {
+			break
+		}
+	}
+	rec.Duration = time.Since(rec.Start)
+
+	canceled := ctx.Err() == context.Canceled
+	switch {
+	case canceled:
+		// interrupted by Stop, not a failure
+		err = nil
+		rec.Error = "Canceled by worker stop."
+	case ctx.Err() == context.DeadlineExceeded && (err == nil || err == context.DeadlineExceeded):
+		err = &Error{Type: "TIMEOUT", Message: "Worker run exceeded timeout " + timeout.String() + "."}
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	worker.lock.Lock()
+	worker.running--
+	if err != nil {
+		worker.failures++
+	}
+	worker.history = append(worker.history, rec)
+	if len(worker.history) > workerHistorySize {
+		worker.history = worker.history[len(worker.history)-workerHistorySize:]
+	}
+	hooks := worker.onSuccess
+	if err != nil {
+		hooks = worker.onError
+	}
+	worker.lock.Unlock()
+
+	if err != nil {
+		fields := []Field{F("worker", worker.Name), F("duration", rec.Duration.String()), F("attempts", rec.Attempts), F("error", err)}
+		if e, ok := err.(*Error); ok && e.Type == "PANIC" {
+			fields = append(fields, F("stack", e.Data))
+		}
+		worker.log().Error("Worker run failed.", fields...)
+	}
+	if !canceled {
+		for _, hook := range hooks {
+			worker.callHook(hook, rec, err)
+		}
+	}
+}
+
+// callHook run hook, a panicking hook must not kill the worker
+func (worker *Worker) callHook(hook WorkerHook, rec WorkerRun, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			worker.log().Error("Worker hook panic", F("worker", worker.Name), F("panic", fmt.Sprint(r)))
+		}
+	}()
+	hook(worker, rec, err)
+}
+
+// retryDelay exponential backoff with jitter, attempt starts from 1
+func retryDelay(attempt int, backoff time.Duration, maxBackoff time.Duration) time.Duration {
+	d := backoff
+	// without cap, stop doubling before overflow
+	for i := 1; i < attempt && (maxBackoff <= 0 || d < maxBackoff) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if maxBackoff > 0 && d > maxBackoff {
+		d = maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// sleepCtx wait d, return false if ctx is done first
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (worker *Worker) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Error{Type: "PANIC", Message: fmt.Sprint(r), Data: string(debug.Stack())}
+		}
+	}()
+
+	if worker.errorTask != nil {
+		return worker.errorTask(ctx)
+	}
+	if worker.contextTask != nil {
+		worker.contextTask(ctx)
+		return nil
+	}
 	worker.Task()
-	tick := time.NewTicker(time.Second * time.Duration(worker.period))
-	go worker.scheduler(tick)
+	return nil
+}
+
+// Status ...
+func (worker *Worker) Status() WorkerStatus {
+	leader := worker.IsLeader()
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
-	tick.Stop()
-	os.Exit(0)
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	st := WorkerStatus{
+		Name:      worker.Name,
+		Delay:     worker.delay,
+		Period:    worker.period,
+		Overlap:   worker.overlap,
+		Singleton: worker.lease != nil,
+		Running:   worker.running,
+		Skipped:   worker.skipped,
+		Failures:  worker.failures,
+	}
+	if st.Overlap == "" {
+		st.Overlap = OverlapSkip
+	}
+	if worker.cron != nil {
+		st.Cron = worker.cron.Expr
+	}
+	if !worker.nextRun.IsZero() {
+		next := worker.nextRun
+		st.NextRun = &next
+	}
+	if len(worker.history) > 0 {
+		last := worker.history[len(worker.history)-1]
+		st.LastRun = &last
+	}
+
+	switch {
+	case worker.running > 0:
+		st.State = WorkerRunning
+	case worker.done == nil || worker.now == nil:
+		// not started, stopped or one-shot schedule finished
+		st.State = WorkerStopped
+	case !leader:
+		st.State = WorkerStandby
+	case worker.paused:
+		st.State = WorkerPaused
+	default:
+		st.State = WorkerIdle
+	}
+	return st
 }
 
-func (worker *Worker) scheduler(tick *time.Ticker) {
-	for range tick.C {
-		worker.Task()
+// History recent runs, oldest first
+func (worker *Worker) History() []WorkerRun {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	list := make([]WorkerRun, len(worker.history))
+	copy(list, worker.history)
+	return list
+}
+
+// LastRun most recent finished run, false if the task has not run yet
+func (worker *Worker) LastRun() (WorkerRun, bool) {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	if len(worker.history) == 0 {
+		return WorkerRun{}, false
 	}
+	return worker.history[len(worker.history)-1], true
+}
+
+// Running number of runs in progress
+func (worker *Worker) Running() int {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.running
+}
+
+// Skipped number of runs dropped by overlap policy
+func (worker *Worker) Skipped() int64 {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.skipped
+}
+
+// Failures number of runs ended with error, panic or timeout
+func (worker *Worker) Failures() int64 {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	return worker.failures
 }
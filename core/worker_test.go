@@ -0,0 +1,335 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer log output read while workers write to it
+type logBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// startWorker start worker whose schedule never comes during the test, runs are triggered by TriggerNow
+func startWorker(t *testing.T, worker *Worker) *Worker {
+	worker.SetName("test").SetDelay(3600)
+	if err := worker.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { worker.Stop(context.Background()) })
+	return worker
+}
+
+func triggerNow(t *testing.T, worker *Worker) {
+	// TriggerNow merges triggers not yet picked by the schedule, wait for it to pick this one
+	picked := func() bool {
+		worker.lock.Lock()
+		defer worker.lock.Unlock()
+		return len(worker.now) == 0
+	}
+	if !waitFor(time.Second, picked) {
+		t.Fatal("previous trigger not picked")
+	}
+	if err := worker.TriggerNow(); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(time.Second, picked) {
+		t.Fatal("trigger not picked")
+	}
+}
+
+// blockingTask task blocking until release is closed, started receives a value per run
+func blockingTask() (task Task, started chan struct{}, release chan struct{}) {
+	started = make(chan struct{}, 32)
+	release = make(chan struct{})
+	return func() {
+		started <- struct{}{}
+		<-release
+	}, started, release
+}
+
+func waitStarted(t *testing.T, started chan struct{}) {
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("run not started")
+	}
+}
+
+func TestWorkerOverlapSkip(t *testing.T) {
+	task, started, release := blockingTask()
+	worker := startWorker(t, (&Worker{}).SetTask(task))
+
+	triggerNow(t, worker)
+	waitStarted(t, started)
+	triggerNow(t, worker)
+	if !waitFor(time.Second, func() bool { return worker.Skipped() == 1 }) {
+		t.Fatalf("Skipped() = %d, want 1", worker.Skipped())
+	}
+	close(release)
+	if !waitFor(time.Second, func() bool { return len(worker.History()) == 1 && worker.Running() == 0 }) {
+		t.Fatalf("History() = %v, want 1 run", worker.History())
+	}
+	// not busy anymore
+	triggerNow(t, worker)
+	if !waitFor(time.Second, func() bool { return len(worker.History()) == 2 }) {
+		t.Fatalf("History() = %v, want 2 runs", worker.History())
+	}
+}
+
+func TestWorkerOverlapQueue(t *testing.T) {
+	task, started, release := blockingTask()
+	worker := startWorker(t, (&Worker{}).SetTask(task).SetOverlap(OverlapQueue))
+
+	triggerNow(t, worker)
+	waitStarted(t, started)
+	triggerNow(t, worker)
+	triggerNow(t, worker)
+	if worker.Running() != 1 || worker.Skipped() != 0 {
+		t.Fatalf("Running() = %d & Skipped() = %d, want queued runs waiting", worker.Running(), worker.Skipped())
+	}
+	close(release)
+	if !waitFor(time.Second, func() bool { return len(worker.History()) == 3 }) {
+		t.Fatalf("History() = %v, want the 2 queued runs done", worker.History())
+	}
+}
+
+func TestWorkerOverlapAllow(t *testing.T) {
+	task, started, release := blockingTask()
+	worker := startWorker(t, (&Worker{}).SetTask(task).SetOverlap(OverlapAllow))
+
+	triggerNow(t, worker)
+	triggerNow(t, worker)
+	waitStarted(t, started)
+	waitStarted(t, started)
+	if worker.Running() != 2 {
+		t.Fatalf("Running() = %d, want 2 concurrent runs", worker.Running())
+	}
+	if st := worker.Status(); st.State != WorkerRunning || st.Running != 2 {
+		t.Fatalf("Status() = %+v, want RUNNING with 2 runs", st)
+	}
+	close(release)
+	if !waitFor(time.Second, func() bool { return len(worker.History()) == 2 }) {
+		t.Fatalf("History() = %v, want 2 runs", worker.History())
+	}
+}
+
+func TestWorkerTriggerSkipWithQueuedRuns(t *testing.T) {
+	worker := (&Worker{Name: "test"}).SetOverlap(OverlapQueue)
+	// runs queued under QUEUE policy, nobody executing them
+	runs := make(chan struct{}, 1)
+	runs <- struct{}{}
+	worker.SetOverlap(OverlapSkip)
+
+	returned := make(chan struct{})
+	go func() {
+		worker.trigger(context.Background(), runs, &sync.WaitGroup{})
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("trigger blocked on a full run queue")
+	}
+	if worker.Skipped() != 1 {
+		t.Fatalf("Skipped() = %d, want 1", worker.Skipped())
+	}
+}
+
+func TestWorkerPanic(t *testing.T) {
+	var logs logBuffer
+	calls := 0
+	worker := startWorker(t, (&Worker{}).SetLogger(NewLogger(&logs, LoggerConfig{Level: LevelDebug})).SetTask(func() {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+	}))
+
+	triggerNow(t, worker)
+	if !waitFor(time.Second, func() bool { return worker.Failures() == 1 }) {
+		t.Fatalf("Failures() = %d, want 1", worker.Failures())
+	}
+	run, _ := worker.LastRun()
+	if !strings.Contains(run.Error, "PANIC") || !strings.Contains(run.Error, "boom") {
+		t.Fatalf("LastRun().Error = %q, want the panic", run.Error)
+	}
+	if !strings.Contains(logs.String(), "stack") {
+		t.Fatalf("panic logged without stack: %s", logs.String())
+	}
+
+	// the worker survives its task
+	triggerNow(t, worker)
+	if !waitFor(time.Second, func() bool { return len(worker.History()) == 2 }) {
+		t.Fatalf("History() = %v, want a second run", worker.History())
+	}
+	if run, _ := worker.LastRun(); run.Error != "" || worker.Failures() != 1 {
+		t.Fatalf("LastRun() = %+v with Failures() = %d, want a successful run", run, worker.Failures())
+	}
+}
+
+func TestWorkerTimeout(t *testing.T) {
+	canceled := make(chan error, 1)
+	worker := startWorker(t, (&Worker{}).SetTimeout(20*time.Millisecond).SetContextTask(func(ctx context.Context) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+	}))
+
+	triggerNow(t, worker)
+	select {
+	case err := <-canceled:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("task ctx error = %v, want deadline exceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task ctx not done after timeout")
+	}
+	if !waitFor(time.Second, func() bool { return worker.Failures() == 1 }) {
+		t.Fatalf("Failures() = %d, want 1", worker.Failures())
+	}
+	if run, _ := worker.LastRun(); !strings.Contains(run.Error, "TIMEOUT") {
+		t.Fatalf("LastRun().Error = %q, want TIMEOUT", run.Error)
+	}
+}
+
+func TestWorkerHistory(t *testing.T) {
+	worker := startWorker(t, (&Worker{}).SetTask(func() {}))
+	for i := 0; i < workerHistorySize+5; i++ {
+		triggerNow(t, worker)
+		n := i + 1
+		if n > workerHistorySize {
+			n = workerHistorySize
+		}
+		if !waitFor(time.Second, func() bool { return len(worker.History()) == n && worker.Running() == 0 }) {
+			t.Fatalf("run %d: len(History()) = %d, want %d", i+1, len(worker.History()), n)
+		}
+	}
+	list := worker.History()
+	for i := 1; i < len(list); i++ {
+		if list[i].Start.Before(list[i-1].Start) {
+			t.Fatalf("History() not oldest first: %v", list)
+		}
+	}
+	if last, _ := worker.LastRun(); last != list[len(list)-1] {
+		t.Fatalf("LastRun() = %+v, want the last of History()", last)
+	}
+}
+
+func TestWorkerRestartAfterStop(t *testing.T) {
+	task, started, release := blockingTask()
+	worker := startWorker(t, (&Worker{}).SetTask(task))
+	triggerNow(t, worker)
+	waitStarted(t, started)
+
+	// the task ignores cancellation, Stop gives up waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := worker.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Stop() = %v, want deadline exceeded", err)
+	}
+	err := worker.Start(context.Background())
+	if e, ok := err.(*Error); !ok || e.Type != "STOPPING" {
+		t.Fatalf("Start() while the previous loop runs = %v, want STOPPING", err)
+	}
+
+	close(release)
+	if err := worker.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	if err := worker.Start(context.Background()); err != nil {
+		t.Fatalf("Start() after stopped = %v", err)
+	}
+	if err := worker.Start(context.Background()); err == nil {
+		t.Fatal("Start() of a running worker = nil")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt    int
+		backoff    time.Duration
+		maxBackoff time.Duration
+		want       time.Duration
+	}{
+		{1, 100 * time.Millisecond, 0, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 0, 200 * time.Millisecond},
+		{4, 100 * time.Millisecond, 0, 800 * time.Millisecond},
+		{4, 100 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond},
+		{1, 100 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond},
+		{1000, time.Second, time.Minute, time.Minute},
+		// no cap, doubling stops before overflow
+		{1000, time.Second, 0, time.Second << 33},
+		{3, 0, time.Minute, 0},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := retryDelay(tt.attempt, tt.backoff, tt.maxBackoff)
+			// jitter between half & full delay
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("retryDelay(%d, %s, %s) = %s, want within [%s, %s]", tt.attempt, tt.backoff, tt.maxBackoff, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestWorkerHooks(t *testing.T) {
+	type call struct {
+		success bool
+		run     WorkerRun
+		err     error
+	}
+	calls := make(chan call, 8)
+	failures := 0
+	worker := (&Worker{}).SetRetry(2, time.Millisecond, time.Millisecond).SetErrorTask(func(ctx context.Context) error {
+		// first run fails once then succeeds, second run fails every attempt
+		failures++
+		if failures == 2 {
+			return nil
+		}
+		return errors.New("failed")
+	})
+	worker.OnSuccess(func(w *Worker, run WorkerRun, err error) { calls <- call{true, run, err} })
+	worker.OnError(func(w *Worker, run WorkerRun, err error) { calls <- call{false, run, err} })
+	startWorker(t, worker)
+
+	next := func() call {
+		select {
+		case c := <-calls:
+			return c
+		case <-time.After(time.Second):
+			t.Fatal("hook not called")
+		}
+		return call{}
+	}
+	triggerNow(t, worker)
+	if c := next(); !c.success || c.err != nil || c.run.Attempts != 2 {
+		t.Fatalf("hook of the first run = %+v, want success after 2 attempts", c)
+	}
+	triggerNow(t, worker)
+	if c := next(); c.success || c.err == nil || c.run.Attempts != 3 || c.run.Error != "failed" {
+		t.Fatalf("hook of the second run = %+v, want error after 3 attempts", c)
+	}
+	select {
+	case c := <-calls:
+		t.Fatalf("hook called again: %+v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
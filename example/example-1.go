@@ -1,6 +1,7 @@
 package example
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"math/rand"
@@ -18,7 +19,7 @@ func UpgradeWebsocket(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	err = srv.Poll.Add(conn)
+	_, err = srv.AddConn(conn)
 	if err != nil {
 		log.Printf("FAIL TO ADD CONNECTION")
 		conn.Close()
@@ -39,7 +40,7 @@ func main() {
 	}
 }
 
-func handleOrder(request core.Request) core.Response {
+func handleOrder(ctx context.Context, request core.Request) core.Response {
 
 	by, err := json.Marshal(request.Data)
 	if err != nil {
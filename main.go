@@ -1,33 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/binhgo/foosee/core"
-	"github.com/gobwas/ws"
 )
 
-var srv *core.Server
-
 func main() {
 
-	srv = core.NewServer(-10)
+	srv := core.NewServer(-10)
+	srv.SetServices(core.NewServices().AddCache("order", core.NewLCache(1000, 60)))
 	go srv.Start()
 
-	srv.SetHandle("GET-ORDER", handleOrder)
+	srv.SetHandle("GET-ORDER", handleOrder).SetTimeout(5 * time.Second)
 
-	http.HandleFunc("/", UpgradeWebsocket)
+	http.Handle("/", srv)
 	err := http.ListenAndServe(":8000", nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func handleOrder(request core.Request) core.Response {
+func handleOrder(ctx context.Context, request core.Request) core.Response {
 
 	by, err := json.Marshal(request.Data)
 	if err != nil {
@@ -46,26 +46,26 @@ func handleOrder(request core.Request) core.Response {
 		}
 	}
 
-	md := data.Name
-	md = md + "-" + strconv.Itoa(rand.Intn(100000))
-
-	return core.Response{
-		Status:  "OK",
-		Message: md,
+	load := func(name string) (interface{}, error) {
+		return name + "-" + strconv.Itoa(rand.Intn(100000)), nil
 	}
-}
-
-func UpgradeWebsocket(w http.ResponseWriter, r *http.Request) {
 
-	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	var md interface{}
+	if cache := core.ServicesFromContext(ctx).Cache("order"); cache != nil {
+		md, err = cache.GetOrLoad(data.Name, load)
+	} else {
+		md, err = load(data.Name)
+	}
 	if err != nil {
-		return
+		return core.Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		}
 	}
 
-	err = srv.Poll.Add(conn)
-	if err != nil {
-		log.Printf("FAIL TO ADD CONNECTION")
-		conn.Close()
+	return core.Response{
+		Status:  "OK",
+		Message: md.(string),
 	}
 }
 